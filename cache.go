@@ -72,6 +72,18 @@ func (c *Cache) Put(inode fuseops.InodeID, off int64, rd io.Reader) {
 	c.entries[key] = entry
 }
 
+// Drop removes all entries for inode from the cache.
+func (c *Cache) Drop(inode fuseops.InodeID) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for key := range c.entries {
+		if key.Inode == inode {
+			delete(c.entries, key)
+		}
+	}
+}
+
 const (
 	cacheTimeout = 20 * time.Second
 	cacheTicker  = 5 * time.Second
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdGenerate struct {
+	Format string `long:"format"       default:"dir" choice:"dir" choice:"tar" choice:"cpio" description:"write the tree to a directory, or as a tar or cpio (newc) archive"`
+	Output string `long:"output" short:"o"                                                   description:"write the archive to this file instead of stdout"`
+	Owner  bool   `long:"owner"                                                              description:"set the user and group IDs of the files (needs root)"`
+	Xattrs bool   `long:"xattrs"                                                             description:"set extended attributes (not supported for cpio)"`
+}
+
+func init() {
+	_, err := parser.AddCommand("generate",
+		"write the generated tree to a directory or an archive",
+		"The generate command writes the tree described by the global options "+
+			"to a directory, or as a tar or cpio archive to stdout, without "+
+			"mounting it. The content is the same as when reading the files "+
+			"through the mount.",
+		&cmdGenerate{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// warn prints a warning about an entry which cannot be created.
+func warn(p string, err error) {
+	fmt.Fprintf(os.Stderr, "warning: %v: %v\n", p, err)
+}
+
+func (cmd cmdGenerate) Execute(args []string) error {
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	tree := fakedata.NewTree(cfg)
+
+	if cmd.Format == "dir" {
+		if len(args) != 1 {
+			return errors.New("usage: generate [OPTIONS] dir")
+		}
+
+		err = os.MkdirAll(args[0], 0755)
+		if err != nil {
+			return err
+		}
+
+		w := &fakedata.DirWriter{Root: args[0], Owner: cmd.Owner, Xattrs: cmd.Xattrs, Warn: warn, Workers: readWorkers(opts)}
+		return fakedata.WriteTree(tree.Root(), w)
+	}
+
+	if len(args) != 0 {
+		return fmt.Errorf("usage: generate --format %v [--output file]", cmd.Format)
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if cmd.Output != "" {
+		out, err = os.Create(cmd.Output)
+		if err != nil {
+			return err
+		}
+	}
+
+	var w fakedata.TreeWriter
+	switch cmd.Format {
+	case "tar":
+		tw := fakedata.NewTarWriter(out)
+		tw.Xattrs = cmd.Xattrs
+		tw.Warn = warn
+		tw.Workers = readWorkers(opts)
+		w = tw
+	case "cpio":
+		cw := fakedata.NewCpioWriter(out)
+		cw.Workers = readWorkers(opts)
+		w = cw
+	}
+
+	err = fakedata.WriteTree(tree.Root(), w)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdManifest struct {
+	Format      string `long:"format"       default:"json" choice:"json" choice:"csv" description:"write the manifest as JSON or CSV"`
+	Output      string `long:"output" short:"o"                                      description:"write the manifest to this file instead of stdout"`
+	NoChecksums bool   `long:"no-checksums"                                          description:"do not compute the SHA-256 hashes of the files"`
+	Workers     int    `long:"workers"      default:"1"                              description:"number of files hashed in parallel"`
+}
+
+func init() {
+	_, err := parser.AddCommand("manifest",
+		"list all entries of the generated tree with checksums",
+		"The manifest command prints every path of the tree described by the "+
+			"global options with inode, size, mode, modification time and the "+
+			"SHA-256 hash of the content, computed directly from the generator "+
+			"without mounting the file system.",
+		&cmdManifest{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cmd cmdManifest) Execute(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: manifest [OPTIONS]")
+	}
+
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	tree := fakedata.NewTree(cfg)
+
+	m := &fakedata.Manifest{Checksums: !cmd.NoChecksums, Workers: cmd.Workers}
+	err = fakedata.WriteTree(tree.Root(), m)
+	if err != nil {
+		return err
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if cmd.Output != "" {
+		out, err = os.Create(cmd.Output)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cmd.Format == "csv" {
+		err = m.WriteCSV(out)
+	} else {
+		err = m.WriteJSON(out)
+	}
+
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
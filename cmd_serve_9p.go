@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdServe9P struct {
+	Listen string `long:"listen" default:"localhost:5640" description:"TCP address or unix:/path/to/socket to listen on"`
+}
+
+func init() {
+	_, err := parser.AddCommand("serve-9p",
+		"serve the generated tree via 9P2000.L",
+		"The serve-9p command serves the tree described by the global options "+
+			"read-only via the 9P2000.L protocol on a TCP address or a unix "+
+			"socket (unix:/path/to/socket), so it can be mounted with the "+
+			"kernel client (mount -t 9p) where FUSE is not available.",
+		&cmdServe9P{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cmd cmdServe9P) Execute(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: serve-9p [OPTIONS]")
+	}
+
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	network, addr := "tcp", cmd.Listen
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+		// remove a stale socket from a previous run
+		_ = os.Remove(addr)
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	M("serving 9P2000.L on %v:%v\n", network, listener.Addr())
+	srv := &fakedata.NinePServer{Tree: fakedata.NewTree(cfg), Workers: readWorkers(opts)}
+	err = srv.Serve(listener)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdServeHTTP struct {
+	Listen string `long:"listen" default:"localhost:8080" description:"address to listen on"`
+	WebDAV bool   `long:"webdav"                          description:"also allow read-only access via WebDAV"`
+}
+
+func init() {
+	_, err := parser.AddCommand("serve-http",
+		"serve the generated tree via HTTP",
+		"The serve-http command serves the tree described by the global options "+
+			"via HTTP, with listings for directories. Files support range "+
+			"requests, the ETag and Last-Modified headers are derived from the "+
+			"seed and the metadata. With --webdav, read-only WebDAV access "+
+			"(e.g. PROPFIND) is possible as well.",
+		&cmdServeHTTP{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cmd cmdServeHTTP) Execute(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: serve-http [OPTIONS]")
+	}
+
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	h := &fakedata.HTTPHandler{Tree: fakedata.NewTree(cfg), WebDAV: cmd.WebDAV, Workers: readWorkers(opts)}
+	return serveHTTP(cmd.Listen, "tree", h)
+}
+
+// serveHTTP serves requests on the TCP address listen with h until the
+// program is interrupted. The message printed when the server is ready
+// describes what is served.
+func serveHTTP(listen, what string, h http.Handler) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Handler: h}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	M("serving %v on http://%v/\n", what, listener.Addr())
+	err = srv.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdServeS3 struct {
+	Listen string `long:"listen" default:"localhost:9000" description:"address to listen on"`
+	Bucket string `long:"bucket" default:"fakedata"       description:"name of the bucket"`
+}
+
+func init() {
+	_, err := parser.AddCommand("serve-s3",
+		"serve the generated tree via the S3 API",
+		"The serve-s3 command serves the tree described by the global options "+
+			"as a single read-only bucket via a subset of the S3 API "+
+			"(ListObjectsV2, HeadObject and GetObject). The keys are the paths "+
+			"of the files, only path-style requests are supported and any "+
+			"credentials are accepted.",
+		&cmdServeS3{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cmd cmdServeS3) Execute(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: serve-s3 [OPTIONS]")
+	}
+
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	h := &fakedata.S3Handler{Tree: fakedata.NewTree(cfg), Bucket: cmd.Bucket, Workers: readWorkers(opts)}
+	return serveHTTP(cmd.Listen, "bucket "+cmd.Bucket, h)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+type cmdVerify struct {
+	NoContent  bool `long:"no-content"  description:"do not compare the content of files"`
+	NoMetadata bool `long:"no-metadata" description:"do not compare permissions and modification times"`
+	Owner      bool `long:"owner"       description:"compare user and group IDs"`
+}
+
+func init() {
+	_, err := parser.AddCommand("verify",
+		"compare a directory against the generated tree",
+		"The verify command walks a directory, e.g. a restored backup of the "+
+			"file system, and compares names, types, sizes, metadata and content "+
+			"against the tree described by the global options, without mounting "+
+			"it. Missing, extra and changed entries are reported, for corrupted "+
+			"files with the offset of the first difference.",
+		&cmdVerify{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (cmd cmdVerify) Execute(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: verify [OPTIONS] dir")
+	}
+
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	tree := fakedata.NewTree(cfg)
+
+	differences := 0
+	v := fakedata.Verifier{
+		Metadata: !cmd.NoMetadata,
+		Owner:    cmd.Owner,
+		Content:  !cmd.NoContent,
+		Report: func(d fakedata.Difference) {
+			differences++
+			M("%v\n", d)
+		},
+	}
+
+	err = v.Verify(tree.Root(), args[0])
+	if err != nil {
+		return err
+	}
+
+	M("checked %d entries, found %d differences\n", v.Checked, differences)
+	if differences > 0 {
+		return fmt.Errorf("%v does not match the generated tree", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// deltaBlockSize is the granularity in which the data of generated files is
+// copied to the delta when it is overwritten.
+const deltaBlockSize = 64 * 1024
+
+// deltaStore holds the data written to a file in the overlay. Reading data
+// which has not been written returns null bytes.
+type deltaStore interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+	Close() error
+}
+
+// newDeltaStore returns a store in memory if dir is empty, otherwise a
+// temporary file in dir.
+func newDeltaStore(dir string) (deltaStore, error) {
+	if dir == "" {
+		return &memDelta{blocks: make(map[int64][]byte)}, nil
+	}
+
+	f, err := ioutil.TempFile(dir, "fakedatafs-delta-")
+	if err != nil {
+		return nil, err
+	}
+
+	return fileDelta{File: f}, nil
+}
+
+// memDelta keeps the data in blocks of deltaBlockSize bytes in memory.
+type memDelta struct {
+	blocks map[int64][]byte
+}
+
+// ReadAt reads data from the store.
+func (d *memDelta) ReadAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		blk, pos := (off+int64(n))/deltaBlockSize, (off+int64(n))%deltaBlockSize
+
+		buf := p[n:]
+		if len(buf) > int(deltaBlockSize-pos) {
+			buf = buf[:deltaBlockSize-pos]
+		}
+
+		data, ok := d.blocks[blk]
+		if ok {
+			copy(buf, data[pos:])
+		} else {
+			for i := range buf {
+				buf[i] = 0
+			}
+		}
+
+		n += len(buf)
+	}
+
+	return len(p), nil
+}
+
+// WriteAt writes data to the store.
+func (d *memDelta) WriteAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		blk, pos := (off+int64(n))/deltaBlockSize, (off+int64(n))%deltaBlockSize
+
+		data, ok := d.blocks[blk]
+		if !ok {
+			data = make([]byte, deltaBlockSize)
+			d.blocks[blk] = data
+		}
+
+		n += copy(data[pos:], p[n:])
+	}
+
+	return len(p), nil
+}
+
+// Truncate removes all data after size.
+func (d *memDelta) Truncate(size int64) error {
+	for blk, data := range d.blocks {
+		start := blk * deltaBlockSize
+		switch {
+		case start >= size:
+			delete(d.blocks, blk)
+		case start+deltaBlockSize > size:
+			for i := size - start; i < deltaBlockSize; i++ {
+				data[i] = 0
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close releases the memory.
+func (d *memDelta) Close() error {
+	d.blocks = nil
+	return nil
+}
+
+// fileDelta keeps the data in a sparse temporary file.
+type fileDelta struct {
+	*os.File
+}
+
+// ReadAt reads data from the file, data beyond the end is returned as null
+// bytes.
+func (d fileDelta) ReadAt(p []byte, off int64) (int, error) {
+	n, err := d.File.ReadAt(p, off)
+	if err == io.EOF {
+		for i := range p[n:] {
+			p[n+i] = 0
+		}
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+// Close closes and removes the file.
+func (d fileDelta) Close() error {
+	err := d.File.Close()
+	if rerr := os.Remove(d.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package fakedata
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// TarWriter writes a tree as a tar archive in PAX format.
+type TarWriter struct {
+	// Xattrs stores the extended attributes in SCHILY.xattr records.
+	Xattrs bool
+
+	// Warn is called for entries which cannot be stored in a tar archive
+	// (sockets). If it is nil, an error is returned instead.
+	Warn func(p string, err error)
+
+	// Workers is the number of goroutines generating the content of large
+	// files, see FileReader.Workers.
+	Workers int
+
+	tw    *tar.Writer
+	links map[fuseops.InodeID]string
+}
+
+// NewTarWriter returns a writer for a tar archive written to wr.
+func NewTarWriter(wr io.Writer) *TarWriter {
+	return &TarWriter{
+		tw:    tar.NewWriter(wr),
+		links: make(map[fuseops.InodeID]string),
+	}
+}
+
+// Write adds the entry item to the archive.
+func (w *TarWriter) Write(item treeItem) error {
+	hdr := &tar.Header{
+		Name:       item.Path,
+		Mode:       int64(unixMode(item.Attr.Mode) & 07777),
+		Uid:        int(item.Attr.Uid),
+		Gid:        int(item.Attr.Gid),
+		ModTime:    item.Attr.Mtime,
+		AccessTime: item.Attr.Atime,
+		Format:     tar.FormatPAX,
+	}
+
+	if w.Xattrs && len(item.Xattrs) > 0 {
+		hdr.PAXRecords = make(map[string]string, len(item.Xattrs))
+		for _, attr := range item.Xattrs {
+			hdr.PAXRecords["SCHILY.xattr."+attr.Name] = string(attr.Value)
+		}
+	}
+
+	switch item.Type {
+	case fuseutil.DT_Directory:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case fuseutil.DT_File:
+		if item.Attr.Nlink > 1 {
+			if first, ok := w.links[item.Inode]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				break
+			}
+
+			w.links[item.Inode] = item.Path
+		}
+
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(item.File.Size)
+	case fuseutil.DT_Link:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = item.Target
+	case fuseutil.DT_FIFO:
+		hdr.Typeflag = tar.TypeFifo
+	case fuseutil.DT_Char:
+		hdr.Typeflag = tar.TypeChar
+	case fuseutil.DT_Block:
+		hdr.Typeflag = tar.TypeBlock
+	default:
+		err := errors.New("sockets cannot be stored in tar archives")
+		if w.Warn == nil {
+			return fmt.Errorf("%v: %v", item.Path, err)
+		}
+
+		w.Warn(item.Path, err)
+		return nil
+	}
+
+	err := w.tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	if hdr.Typeflag == tar.TypeReg {
+		rd := NewFileReader(item.File)
+		rd.Workers = w.Workers
+		_, err = io.CopyN(w.tw, rd, hdr.Size)
+	}
+
+	return err
+}
+
+// Close writes the end of the archive.
+func (w *TarWriter) Close() error {
+	return w.tw.Close()
+}
+
+// cpioTrailer is the name of the last entry in a cpio archive.
+const cpioTrailer = "TRAILER!!!"
+
+// CpioWriter writes a tree as a cpio archive in the "new ASCII" (newc)
+// format. Extended attributes are not stored.
+type CpioWriter struct {
+	// Workers is the number of goroutines generating the content of large
+	// files, see FileReader.Workers.
+	Workers int
+
+	wr *bufio.Writer
+
+	// remaining is the number of names of files with hardlinks which have
+	// not been written yet, the data is stored with the last name.
+	remaining map[fuseops.InodeID]uint32
+}
+
+// NewCpioWriter returns a writer for a cpio archive written to wr.
+func NewCpioWriter(wr io.Writer) *CpioWriter {
+	return &CpioWriter{
+		wr:        bufio.NewWriter(wr),
+		remaining: make(map[fuseops.InodeID]uint32),
+	}
+}
+
+// pad writes null bytes until the length n is a multiple of four.
+func (w *CpioWriter) pad(n int64) error {
+	_, err := w.wr.Write(make([]byte, (4-n%4)%4))
+	return err
+}
+
+// header writes the header for an entry.
+func (w *CpioWriter) header(name string, inode fuseops.InodeID, mode, uid, gid, nlink uint32, mtime, size int64) error {
+	_, err := fmt.Fprintf(w.wr, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%s\x00",
+		uint32(inode), mode, uid, gid, nlink, uint32(mtime), uint32(size),
+		0, 0, 0, 0, len(name)+1, 0, name)
+	if err != nil {
+		return err
+	}
+
+	return w.pad(110 + int64(len(name)) + 1)
+}
+
+// Write adds the entry item to the archive.
+func (w *CpioWriter) Write(item treeItem) error {
+	var (
+		size int64
+		data io.Reader
+	)
+
+	switch item.Type {
+	case fuseutil.DT_File:
+		size = int64(item.File.Size)
+		rd := NewFileReader(item.File)
+		rd.Workers = w.Workers
+		data = rd
+		if size > math.MaxUint32 {
+			return fmt.Errorf("%v: file is too large for a cpio archive", item.Path)
+		}
+
+		if item.Attr.Nlink > 1 {
+			n, ok := w.remaining[item.Inode]
+			if !ok {
+				n = item.Attr.Nlink
+			}
+			n--
+			w.remaining[item.Inode] = n
+
+			if n > 0 {
+				size, data = 0, nil
+			}
+		}
+	case fuseutil.DT_Link:
+		size = int64(len(item.Target))
+		data = strings.NewReader(item.Target)
+	}
+
+	err := w.header(item.Path, item.Inode, unixMode(item.Attr.Mode), item.Attr.Uid, item.Attr.Gid,
+		item.Attr.Nlink, item.Attr.Mtime.Unix(), size)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	_, err = io.CopyN(w.wr, data, size)
+	if err != nil {
+		return err
+	}
+
+	return w.pad(size)
+}
+
+// Close writes the end of the archive.
+func (w *CpioWriter) Close() error {
+	err := w.header(cpioTrailer, 0, 0, 0, 0, 1, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return w.wr.Flush()
+}
@@ -0,0 +1,110 @@
+package fakedata
+
+import (
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Config describes the tree of fake data.
+type Config struct {
+	// Seed is the initial random seed for the whole tree.
+	Seed int64
+
+	// FormatVersion selects the version of the format of the generated
+	// data, zero selects LatestFormat.
+	FormatVersion int
+
+	// MaxSize is the maximum size of a file in bytes.
+	MaxSize int
+
+	// Sizes is the distribution for the sizes of new files. If it is nil,
+	// sizes are distributed uniformly between zero and MaxSize.
+	Sizes SizeDistribution
+
+	// Contents lists the content generators, one of them is selected for
+	// each file. Compressibility is the fraction of null bytes in files with
+	// ContentCompressible. If Contents is empty, all files contain random
+	// data.
+	Contents        []ContentKind
+	Compressibility float64
+
+	// DupRate is the fraction of segments and DupFileRate the fraction of
+	// files which use a seed from a pool of DupPoolSize shared seeds, so
+	// that they contain duplicate data. Of the duplicate segments, a fraction
+	// DupUnaligned starts at a random offset in the shared data.
+	DupRate      float64
+	DupFileRate  float64
+	DupPoolSize  int
+	DupUnaligned float64
+
+	// SparseRate is the fraction of sparse files. In a sparse file, a
+	// fraction HoleRate of the segments are holes.
+	SparseRate float64
+	HoleRate   float64
+
+	// FilesPerDir and DirsPerDir are the number of files and subdirectories
+	// created in each directory. Subdirectories are created up to Depth
+	// levels below the root.
+	FilesPerDir int
+	DirsPerDir  int
+	Depth       int
+
+	// SymlinksPerDir, HardlinksPerDir and SpecialPerDir are the number of
+	// symlinks, hardlinks and special files (FIFOs, devices, sockets) in
+	// each directory.
+	SymlinksPerDir  int
+	HardlinksPerDir int
+	SpecialPerDir   int
+
+	// Generation is the number of times changes have been applied to the
+	// tree. In each generation, about ChangeRate of all files are modified,
+	// appended to, truncated or deleted, and new files are created.
+	Generation int
+	ChangeRate float64
+
+	// VolatileRate is the fraction of files which change while they are
+	// being read: after VolatileReads reads or VolatileDelay after they
+	// were first accessed, whatever comes first. Zero disables the
+	// respective trigger.
+	VolatileRate  float64
+	VolatileReads int
+	VolatileDelay time.Duration
+
+	// MtimeMin and MtimeMax are the range for the modification times of
+	// the initial generation. Changes in later generations are made after
+	// MtimeMax.
+	MtimeMin, MtimeMax time.Time
+
+	// Uids, Gids and Modes list the values for the owner, group and
+	// permissions, one of them is selected for each file. A fraction
+	// SpecialBitsRate of all files has the setuid, setgid or sticky bit set,
+	// and UnreadableRate of all files are not readable.
+	Uids            IDs
+	Gids            IDs
+	Modes           []os.FileMode
+	SpecialBitsRate float64
+	UnreadableRate  float64
+
+	// XattrsPerFile is the number of user.* extended attributes for each
+	// file and directory, with values of up to XattrMaxSize bytes. A fraction
+	// CapabilityRate has the security.capability attribute, and ACLRate
+	// has an access ACL.
+	XattrsPerFile  int
+	XattrMaxSize   int
+	CapabilityRate float64
+	ACLRate        float64
+
+	// tree contains the settings and fixed entries for subtrees from a
+	// spec, see ApplySpec.
+	tree *specNode
+}
+
+// size returns the size for a new file.
+func (cfg *Config) size(rnd *rand.Rand) int {
+	if cfg.Sizes == nil {
+		return Uniform{Max: cfg.MaxSize}.Size(rnd)
+	}
+
+	return cfg.Sizes.Size(rnd)
+}
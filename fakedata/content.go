@@ -0,0 +1,378 @@
+package fakedata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// ContentKind selects the generator for the content of a segment.
+type ContentKind int
+
+// These are the available content generators.
+const (
+	// ContentRandom is incompressible random data.
+	ContentRandom ContentKind = iota
+	// ContentZero only contains null bytes.
+	ContentZero
+	// ContentPattern repeats a short random pattern.
+	ContentPattern
+	// ContentText consists of lines of random words.
+	ContentText
+	// ContentCompressible is random data interspersed with null bytes, the
+	// fraction of null bytes is the compressibility of the file.
+	ContentCompressible
+	// ContentMixed selects one of the other generators for each segment.
+	ContentMixed
+)
+
+var contentKindNames = map[ContentKind]string{
+	ContentRandom:       "random",
+	ContentZero:         "zero",
+	ContentPattern:      "pattern",
+	ContentText:         "text",
+	ContentCompressible: "compressible",
+	ContentMixed:        "mixed",
+}
+
+func (k ContentKind) String() string {
+	name, ok := contentKindNames[k]
+	if !ok {
+		return fmt.Sprintf("ContentKind(%d)", int(k))
+	}
+
+	return name
+}
+
+// ParseContentKind returns the content kind for name.
+func ParseContentKind(name string) (ContentKind, error) {
+	for kind, n := range contentKindNames {
+		if n == name {
+			return kind, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown content kind %q", name)
+}
+
+// mixedContentKinds are the generators used for segments of ContentMixed files.
+var mixedContentKinds = []ContentKind{
+	ContentRandom,
+	ContentZero,
+	ContentPattern,
+	ContentText,
+	ContentCompressible,
+}
+
+// deriveSeed returns a new seed for purpose derived from seed.
+func deriveSeed(seed int64, purpose string) int64 {
+	return SeedForPath(0, purpose, fmt.Sprintf("%016x", uint64(seed)))
+}
+
+// contentReader returns an endless reader for content of kind with seed in
+// LatestFormat. Compressibility is only used for ContentCompressible.
+func contentReader(kind ContentKind, seed int64, compressibility float64) io.Reader {
+	return contentStream(LatestFormat, kind, seed, compressibility, 0)
+}
+
+// contentGenerator returns the generator for content of kind with seed. The
+// content is endless and ReadAt generates the bytes at any offset directly,
+// without generating the data before it, so reading at an offset takes the
+// same time regardless of the offset. ReadAt always fills the buffer.
+// Compressibility is only used for ContentCompressible.
+func contentGenerator(kind ContentKind, seed int64, compressibility float64) io.ReaderAt {
+	switch kind {
+	case ContentZero:
+		return zeroReader{}
+	case ContentPattern:
+		return newPatternGenerator(seed)
+	case ContentText:
+		return newTextGenerator(seed)
+	case ContentCompressible:
+		return newCompressibleGenerator(seed, compressibility)
+	}
+
+	return newRandomGenerator(seed)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+
+	return len(p), nil
+}
+
+func (z zeroReader) ReadAt(p []byte, off int64) (int, error) {
+	return z.Read(p)
+}
+
+// mix64 is the finalizer of SplitMix64, it maps a counter to a pseudorandom
+// value.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// golden is the increment of the counter for mix64.
+const golden = 0x9e3779b97f4a7c15
+
+// randomGenerator generates random data in counter mode: the eight bytes at
+// offset 8*i are derived from the key and i only.
+type randomGenerator struct {
+	key uint64
+}
+
+func newRandomGenerator(seed int64) randomGenerator {
+	return randomGenerator{key: mix64(uint64(seed))}
+}
+
+// word returns the eight bytes at offset 8*i.
+func (g randomGenerator) word(i uint64) uint64 {
+	return mix64(g.key + i*golden)
+}
+
+func (g randomGenerator) ReadAt(p []byte, off int64) (int, error) {
+	n := len(p)
+	i := uint64(off) / 8
+
+	// unaligned start
+	if skip := int(off % 8); skip != 0 {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], g.word(i))
+		p = p[copy(p, buf[skip:]):]
+		i++
+	}
+
+	// generate four words per iteration, they are independent of each other
+	for len(p) >= 32 {
+		binary.LittleEndian.PutUint64(p[0:], g.word(i))
+		binary.LittleEndian.PutUint64(p[8:], g.word(i+1))
+		binary.LittleEndian.PutUint64(p[16:], g.word(i+2))
+		binary.LittleEndian.PutUint64(p[24:], g.word(i+3))
+		p = p[32:]
+		i += 4
+	}
+
+	for len(p) >= 8 {
+		binary.LittleEndian.PutUint64(p, g.word(i))
+		p = p[8:]
+		i++
+	}
+
+	if len(p) > 0 {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], g.word(i))
+		copy(p, buf[:])
+	}
+
+	return n, nil
+}
+
+// maxPatternLength is the maximal length of the pattern for ContentPattern.
+const maxPatternLength = 4096
+
+type patternGenerator struct {
+	pattern []byte
+}
+
+func newPatternGenerator(seed int64) patternGenerator {
+	rnd := rand.New(rand.NewSource(seed))
+	g := patternGenerator{pattern: make([]byte, 1+rnd.Intn(maxPatternLength))}
+	_, _ = io.ReadFull(newRandReader(rnd), g.pattern)
+	return g
+}
+
+func (g patternGenerator) ReadAt(p []byte, off int64) (int, error) {
+	pos := int(off % int64(len(g.pattern)))
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], g.pattern[pos:])
+		n += c
+		pos = (pos + c) % len(g.pattern)
+	}
+
+	return n, nil
+}
+
+// words is used to generate text content.
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing
+	elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim
+	ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea
+	commodo consequat duis aute irure in reprehenderit voluptate velit esse
+	cillum eu fugiat nulla pariatur excepteur sint occaecat cupidatat non
+	proident sunt culpa qui officia deserunt mollit anim id est laborum backup
+	restore snapshot file directory data archive repository index pack blob
+	tree node chunk hash key lock config`)
+
+// textBlockSize is the size of the blocks of text which are generated
+// independently of each other.
+const textBlockSize = 4096
+
+// textGenerator generates lines of random words. The text is generated in
+// blocks, each block only depends on the seed and its index. The last block
+// is kept, so reading sequentially in small chunks is cheap. It must not be
+// used concurrently.
+type textGenerator struct {
+	key   uint64
+	block []byte
+	index int64
+}
+
+func newTextGenerator(seed int64) *textGenerator {
+	return &textGenerator{key: mix64(uint64(seed)), index: -1}
+}
+
+// generate generates the block with index.
+func (g *textGenerator) generate(index int64) {
+	buf := g.block[:0]
+	ctr := mix64(g.key ^ uint64(index)*golden)
+
+	// each random value is used for eight choices of one byte each
+	var val uint64
+	bits := 0
+	next := func(n int) int {
+		if bits == 0 {
+			ctr += golden
+			val = mix64(ctr)
+			bits = 64
+		}
+
+		b := val & 0xff
+		val >>= 8
+		bits -= 8
+		return int(b * uint64(n) >> 8)
+	}
+
+	for len(buf) < textBlockSize {
+		n := 5 + next(10)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, words[next(len(words))]...)
+		}
+		buf = append(buf, '\n')
+	}
+
+	g.block = buf[:textBlockSize]
+	g.index = index
+}
+
+func (g *textGenerator) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		index := off / textBlockSize
+		if index != g.index {
+			g.generate(index)
+		}
+
+		c := copy(p[n:], g.block[off%textBlockSize:])
+		n += c
+		off += int64(c)
+	}
+
+	return n, nil
+}
+
+// compressibleBlockSize is the size of the blocks for ContentCompressible.
+// Each block starts with random data and is filled up with null bytes.
+const compressibleBlockSize = 64
+
+type compressibleGenerator struct {
+	rnd    randomGenerator
+	random int
+}
+
+func newCompressibleGenerator(seed int64, compressibility float64) compressibleGenerator {
+	random := int((1-compressibility)*compressibleBlockSize + 0.5)
+	random = clamp(random, 0, compressibleBlockSize)
+
+	return compressibleGenerator{
+		rnd:    newRandomGenerator(seed),
+		random: random,
+	}
+}
+
+func (g compressibleGenerator) ReadAt(p []byte, off int64) (int, error) {
+	var tmp [compressibleBlockSize]byte
+	n := 0
+	for n < len(p) {
+		index, pos := off/compressibleBlockSize, int(off%compressibleBlockSize)
+
+		// complete blocks are generated in place
+		block := p[n:]
+		if pos != 0 || len(block) < compressibleBlockSize {
+			block = tmp[:]
+		}
+		block = block[:compressibleBlockSize]
+
+		// the random data of the blocks is taken from a continuous stream
+		_, _ = g.rnd.ReadAt(block[:g.random], index*int64(g.random))
+		for i := g.random; i < len(block); i++ {
+			block[i] = 0
+		}
+
+		if &block[0] == &tmp[0] {
+			copy(p[n:], block[pos:])
+		}
+
+		c := compressibleBlockSize - pos
+		if c > len(p)-n {
+			c = len(p) - n
+		}
+		n += c
+		off += int64(c)
+	}
+
+	return n, nil
+}
+
+// contentKind returns the content kind for the file with seed.
+func (cfg *Config) contentKind(seed int64) ContentKind {
+	switch len(cfg.Contents) {
+	case 0:
+		return ContentRandom
+	case 1:
+		return cfg.Contents[0]
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(seed, "content")))
+	return cfg.Contents[rnd.Intn(len(cfg.Contents))]
+}
+
+// SetContent selects the content generator for all segments of the file.
+func (f *File) SetContent(kind ContentKind, compressibility float64) {
+	f.Content = kind
+	f.Compressibility = compressibility
+	f.setSegmentContent(f.Segments)
+}
+
+// setSegmentContent sets the content generator for segments.
+func (f *File) setSegmentContent(segments []Segment) {
+	for i := range segments {
+		seg := &segments[i]
+		seg.Format = f.Format
+		seg.Content = f.Content
+		seg.Compressibility = f.Compressibility
+
+		if f.Content == ContentMixed {
+			seg.Content = mixedContentKind(seg.Seed)
+		}
+	}
+}
+
+// mixedContentKind selects the generator for a segment with seed in a file
+// with ContentMixed.
+func mixedContentKind(seed int64) ContentKind {
+	rnd := rand.New(rand.NewSource(deriveSeed(seed, "content")))
+	return mixedContentKinds[rnd.Intn(len(mixedContentKinds))]
+}
@@ -0,0 +1,196 @@
+package fakedata
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func readContent(t testing.TB, kind ContentKind, seed int64, size, chunk int) []byte {
+	rd := io.LimitReader(contentReader(kind, seed, 0.5), int64(size))
+	buf := make([]byte, 0, size)
+	tmp := make([]byte, chunk)
+	for {
+		n, err := rd.Read(tmp)
+		buf = append(buf, tmp[:n]...)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buf
+}
+
+func TestContentDeterministic(t *testing.T) {
+	for kind := range contentKindNames {
+		if kind == ContentMixed {
+			continue
+		}
+
+		buf := readContent(t, kind, 23, 100000, 100000)
+		if len(buf) != 100000 {
+			t.Fatalf("%v: want %d bytes, got %d", kind, 100000, len(buf))
+		}
+
+		for _, chunk := range []int{1, 7, 100, 4097} {
+			buf2 := readContent(t, kind, 23, 100000, chunk)
+			if !bytes.Equal(buf, buf2) {
+				t.Errorf("%v: content differs when read in chunks of %d bytes", kind, chunk)
+			}
+		}
+	}
+}
+
+func TestContentReadAt(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	for kind := range contentKindNames {
+		if kind == ContentMixed {
+			continue
+		}
+
+		buf := readContent(t, kind, 23, 100000, 100000)
+		gen := contentGenerator(kind, 23, 0.5)
+		for i := 0; i < 50; i++ {
+			off := rnd.Intn(len(buf))
+			l := rnd.Intn(len(buf) - off)
+			if i%2 == 0 && l > 100 {
+				l = rnd.Intn(100)
+			}
+
+			buf2 := make([]byte, l)
+			n, err := gen.ReadAt(buf2, int64(off))
+			if err != nil || n != l {
+				t.Fatalf("%v: ReadAt returned %v, %v", kind, n, err)
+			}
+
+			if !bytes.Equal(buf2, buf[off:off+l]) {
+				t.Errorf("%v: wrong content at offset %v, len %v", kind, off, l)
+			}
+		}
+	}
+}
+
+func compressedSize(t testing.TB, buf []byte) int {
+	var out bytes.Buffer
+	wr, err := flate.NewWriter(&out, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = wr.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Len()
+}
+
+var contentCompressionTests = []struct {
+	kind     ContentKind
+	min, max float64
+}{
+	{ContentRandom, 0.99, 1.01},
+	{ContentZero, 0, 0.01},
+	{ContentPattern, 0, 0.1},
+	{ContentText, 0.2, 0.6},
+	{ContentCompressible, 0.45, 0.6},
+}
+
+func TestContentCompression(t *testing.T) {
+	size := 1 << 20
+	for _, test := range contentCompressionTests {
+		buf := readContent(t, test.kind, 42, size, size)
+		ratio := float64(compressedSize(t, buf)) / float64(size)
+		if ratio < test.min || ratio > test.max {
+			t.Errorf("%v: compression ratio %.3f not in [%v, %v]", test.kind, ratio, test.min, test.max)
+		}
+	}
+}
+
+func TestFileMixedContent(t *testing.T) {
+	f := NewFile(23, 50<<20, 0)
+	f.SetContent(ContentMixed, 0.5)
+
+	kinds := make(map[ContentKind]int)
+	for _, seg := range f.Segments {
+		kinds[seg.Content]++
+	}
+
+	if len(kinds) < 3 {
+		t.Errorf("want several content kinds for mixed file, got %v", kinds)
+	}
+
+	buf, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf2 := make([]byte, 3<<20)
+	off := int64(7<<20 + 123)
+	n, err := f.ReadAt(buf2, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf2[:n], buf[off:off+int64(n)]) {
+		t.Errorf("ReadAt returned wrong data")
+	}
+
+	buf3 := make([]byte, len(buf))
+	_, err = io.ReadFull(ContinuousFileReader(f, 0), buf3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, buf3) {
+		t.Errorf("ContinuousFileReader returned wrong data")
+	}
+}
+
+func TestParseContentKind(t *testing.T) {
+	for kind, name := range contentKindNames {
+		k, err := ParseContentKind(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if k != kind {
+			t.Errorf("ParseContentKind(%q) = %v, want %v", name, k, kind)
+		}
+	}
+
+	_, err := ParseContentKind("foo")
+	if err == nil {
+		t.Errorf("expected error for unknown content kind not found")
+	}
+}
+
+func BenchmarkContent(b *testing.B) {
+	for _, kind := range []ContentKind{ContentRandom, ContentZero, ContentPattern, ContentText, ContentCompressible} {
+		b.Run(kind.String(), func(b *testing.B) {
+			gen := contentGenerator(kind, 23, 0.5)
+			buf := make([]byte, 1<<20)
+
+			b.SetBytes(int64(len(buf)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_, err := gen.ReadAt(buf, int64(i)*int64(len(buf)))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package fakedata
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// The pool of shared seeds is used to generate duplicate data. Segments or
+// whole files which are selected as duplicates use one of the seeds of the
+// pool instead of their own.
+
+// poolSeed returns the seed number i of the pool for segments.
+func (cfg *Config) poolSeed(i int) int64 {
+	return SeedForPath(0, "pool", fmt.Sprintf("%016x/%d", uint64(cfg.Seed), i))
+}
+
+// poolFileSeed returns the seed number i of the pool for whole files.
+func (cfg *Config) poolFileSeed(i int) int64 {
+	return SeedForPath(0, "pool-file", fmt.Sprintf("%016x/%d", uint64(cfg.Seed), i))
+}
+
+// poolSize returns the number of seeds in the pool.
+func (cfg *Config) poolSize() int {
+	if cfg.DupPoolSize <= 0 {
+		return 1
+	}
+
+	return cfg.DupPoolSize
+}
+
+// duplicateFile replaces the content seed and size of entry with one from the
+// pool for a fraction DupFileRate of all files, so the file has exactly the
+// same content as all other files using this seed. Before FormatV3, the seed
+// for the metadata is replaced as well, so all duplicates of a file also
+// have the same metadata.
+func (cfg *Config) duplicateFile(entry *DirEntry) {
+	if cfg.DupFileRate <= 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(entry.Seed, "dup")))
+	if rnd.Float64() >= cfg.DupFileRate {
+		return
+	}
+
+	entry.ContentSeed = cfg.poolFileSeed(rnd.Intn(cfg.poolSize()))
+	entry.Size = cfg.size(rand.New(rand.NewSource(entry.ContentSeed)))
+	entry.BaseSize = entry.Size
+	if cfg.format() < FormatV3 {
+		entry.Seed = entry.ContentSeed
+	}
+}
+
+// shareSegments replaces the seeds of a fraction DupRate of all segments in f
+// with seeds from the pool. A fraction DupUnaligned of those segments does
+// not start at the beginning of the data for the seed but at a random offset.
+func (cfg *Config) shareSegments(f *File) {
+	if cfg.DupRate <= 0 {
+		return
+	}
+
+	for i := range f.Segments {
+		seg := &f.Segments[i]
+		rnd := rand.New(rand.NewSource(deriveSeed(seg.Seed, "dup")))
+		if rnd.Float64() >= cfg.DupRate {
+			continue
+		}
+
+		seg.Seed = cfg.poolSeed(rnd.Intn(cfg.poolSize()))
+		seg.Offset = 0
+		if rnd.Float64() < cfg.DupUnaligned {
+			seg.Offset = int64(1 + rnd.Intn(maxSegmentSize))
+		}
+
+		// the content of the shared segment depends on the seed only
+		seg.Content = cfg.contentKind(seg.Seed)
+		if seg.Content == ContentMixed {
+			seg.Content = mixedContentKind(seg.Seed)
+		}
+		seg.Compressibility = cfg.Compressibility
+	}
+}
@@ -0,0 +1,173 @@
+package fakedata
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSharedSegments(t *testing.T) {
+	cfg := Config{Seed: 23, MaxSize: 20 << 20, FilesPerDir: 20, DupRate: 0.5, DupPoolSize: 3, DupUnaligned: 0.5}
+	d := NewDir(&cfg, 23, "/", 0)
+
+	// remember the data for each shared segment and compare it to all other
+	// segments using the same seed
+	type shared struct {
+		offset int64
+		data   []byte
+	}
+	seen := make(map[int64]shared)
+	matches, unaligned := 0, 0
+
+	for _, entry := range d.entries {
+		f := d.File(entry)
+		buf, err := f.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pos := 0
+		for _, seg := range f.Segments {
+			data := buf[pos : pos+seg.Size]
+			pos += seg.Size
+
+			isPool := false
+			for i := 0; i < cfg.DupPoolSize; i++ {
+				if cfg.poolSeed(i) == seg.Seed {
+					isPool = true
+				}
+			}
+
+			if !isPool {
+				continue
+			}
+
+			if seg.Offset != 0 {
+				unaligned++
+			}
+
+			prev, ok := seen[seg.Seed]
+			if !ok {
+				seen[seg.Seed] = shared{offset: seg.Offset, data: data}
+				continue
+			}
+
+			// compare the overlapping part of both segments
+			start, end := prev.offset, prev.offset+int64(len(prev.data))
+			if seg.Offset > start {
+				start = seg.Offset
+			}
+			if e := seg.Offset + int64(len(data)); e < end {
+				end = e
+			}
+
+			if start >= end {
+				continue
+			}
+
+			if !bytes.Equal(prev.data[start-prev.offset:end-prev.offset], data[start-seg.Offset:end-seg.Offset]) {
+				t.Errorf("%v: shared segment %v contains different data", entry.Name, seg)
+			}
+			matches++
+		}
+	}
+
+	if matches == 0 {
+		t.Errorf("no overlapping shared segments found")
+	}
+
+	if unaligned == 0 {
+		t.Errorf("no unaligned shared segments found")
+	}
+}
+
+func TestSegmentOffset(t *testing.T) {
+	seg := Segment{Seed: 42, Size: 1000}
+	buf := make([]byte, 2000)
+	_, err := io.ReadFull(io.LimitReader(contentReader(seg.Content, seg.Seed, 0), 2000), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seg.Offset = 777
+	buf2 := make([]byte, seg.Size)
+	_, err = io.ReadFull(seg.Reader(), buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf[777:1777], buf2) {
+		t.Errorf("segment with offset returned wrong data")
+	}
+}
+
+func TestDuplicateFiles(t *testing.T) {
+	cfg := Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 50, DupFileRate: 0.5, DupPoolSize: 2}
+	d := NewDir(&cfg, 23, "/", 0)
+
+	content := make(map[int64][]byte)
+	seeds := make(map[int64]string)
+	dups := 0
+	for _, entry := range d.entries {
+		// duplicates share the content, but not the metadata
+		if other, ok := seeds[entry.Seed]; ok {
+			t.Errorf("%v: same seed as %v", entry.Name, other)
+		}
+		seeds[entry.Seed] = entry.Name
+
+		buf, err := d.File(entry).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prev, ok := content[entry.ContentSeed]
+		if !ok {
+			content[entry.ContentSeed] = buf
+			continue
+		}
+
+		dups++
+		if !bytes.Equal(prev, buf) {
+			t.Errorf("%v: duplicate file has different content", entry.Name)
+		}
+	}
+
+	if dups == 0 {
+		t.Errorf("no duplicate files found")
+	}
+
+	// before FormatV3, duplicates also share the seed for the metadata
+	cfg.FormatVersion = FormatV2
+	for _, entry := range NewDir(&cfg, 23, "/", 0).entries {
+		if entry.Seed != entry.ContentSeed {
+			t.Errorf("%v: different seeds for content and metadata in format %d", entry.Name, cfg.FormatVersion)
+		}
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	cfg := Config{Seed: 23, MaxSize: 10 << 20, FilesPerDir: 10, DirsPerDir: 2, Depth: 1}
+	stats, err := TreeStats(NewDir(&cfg, 23, "/", cfg.Depth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Dirs != 2 || stats.Files != 30 {
+		t.Errorf("wrong number of dirs or files: %v", stats)
+	}
+
+	if stats.Bytes != stats.UniqueBytes {
+		t.Errorf("tree without duplicates reports duplicate data: %v", stats)
+	}
+
+	cfg.DupRate = 0.5
+	cfg.DupPoolSize = 5
+	stats, err = TreeStats(NewDir(&cfg, 23, "/", cfg.Depth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.DuplicateRatio() < 0.1 {
+		t.Errorf("too few duplicate data: %v", stats)
+	}
+}
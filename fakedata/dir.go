@@ -0,0 +1,301 @@
+package fakedata
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math/rand"
+	"path"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// SeedForPath returns a new seed for an item of typ at path below an item
+// with parentSeed.
+func SeedForPath(parentSeed int64, tpe string, path string) (seed int64) {
+	s := fmt.Sprintf("seed-%16x/%s/%s", parentSeed, tpe, path)
+	hash := sha1.Sum([]byte(s))
+	for i := 0; i < 8; i++ {
+		shift := uint(i) * 8
+		seed |= int64(hash[i]) << shift
+	}
+
+	return seed
+}
+
+// seedForPath returns the seed for an item of typ at path below an item with
+// parentSeed in the selected format. Before FormatV3, the seed of the parent
+// is not used, so the seed only depends on the path.
+func (cfg *Config) seedForPath(parentSeed int64, tpe string, path string) int64 {
+	if cfg.format() < FormatV3 {
+		parentSeed = 0
+	}
+
+	return SeedForPath(parentSeed, tpe, path)
+}
+
+// DirEntry is an entry within a directory. It contains everything needed to
+// generate the file or subdirectory on demand.
+type DirEntry struct {
+	fuseutil.Dirent
+
+	Seed int64
+
+	// ContentSeed is the seed for the content of a file. It differs from Seed
+	// for duplicate files, which share it with other files.
+	ContentSeed int64
+
+	// Size is the current size of the file, BaseSize the size when the file
+	// was created.
+	Size     int
+	BaseSize int
+
+	// Changes lists the changes applied to the file since it was created in
+	// generation Created. Modified is the generation of the last change.
+	Changes  []Change
+	Created  int
+	Modified int
+
+	// Target is the target of a symlink.
+	Target string
+
+	// Nlink is the number of names of a file with hardlinks.
+	Nlink uint32
+
+	// fixed is set for entries at a fixed path from a spec.
+	fixed *fixedEntry
+}
+
+// Dir is a directory containing fake data. Only the list of entries is
+// generated, files and subdirectories are created when requested.
+type Dir struct {
+	cfg      *Config
+	seed     int64
+	path     string
+	depth    int
+	modified int
+
+	// node contains the settings and fixed entries from a spec, if any.
+	node *specNode
+
+	entries []DirEntry
+	names   map[string]int
+}
+
+// NewDir initializes a directory with cfg.FilesPerDir files and, as long as
+// depth is larger than zero, cfg.DirsPerDir subdirectories. Afterwards, all
+// generations up to cfg.Generation are applied and the fixed entries for dir
+// from the spec are added.
+func NewDir(cfg *Config, seed int64, dir string, depth int) *Dir {
+	return newDir(cfg, cfg.tree.find(dir), seed, dir, depth)
+}
+
+// newDir initializes a directory with the fixed entries from node, which may
+// be nil.
+func newDir(cfg *Config, node *specNode, seed int64, dir string, depth int) *Dir {
+	d := Dir{
+		cfg:   cfg,
+		seed:  seed,
+		path:  dir,
+		depth: depth,
+		node:  node,
+	}
+
+	numFiles, numDirs := cfg.FilesPerDir, cfg.DirsPerDir
+	if depth <= 0 {
+		numDirs = 0
+	}
+
+	if node != nil && node.implicit {
+		numFiles, numDirs = 0, 0
+	}
+
+	d.entries = make([]DirEntry, 0, numFiles+numDirs)
+
+	debugf("generate dir %v with %d files and %d dirs\n", d, numFiles, numDirs)
+	rnd := rand.New(rand.NewSource(d.seed))
+	for i := 0; i < numFiles; i++ {
+		name := fmt.Sprintf("file-%d", rnd.Int())
+		d.entries = append(d.entries, d.newFile(name, cfg.size(rnd)))
+	}
+
+	for i := 0; i < numDirs; i++ {
+		name := fmt.Sprintf("dir-%d", rnd.Int())
+		p := path.Join(d.path, name)
+
+		d.entries = append(d.entries, DirEntry{
+			Dirent: fuseutil.Dirent{
+				Name:  name,
+				Type:  fuseutil.DT_Directory,
+				Inode: d.cfg.inode(p),
+			},
+			Seed: d.cfg.seedForPath(d.seed, "dir", p),
+		})
+	}
+
+	for gen := 1; gen <= cfg.Generation; gen++ {
+		d.applyGeneration(gen)
+	}
+
+	d.addFixed()
+	if node == nil || !node.implicit {
+		d.addLinks()
+	}
+	d.reindex()
+
+	return &d
+}
+
+// newFile returns the entry for a new file in d.
+func (d *Dir) newFile(name string, size int) DirEntry {
+	p := path.Join(d.path, name)
+	entry := DirEntry{
+		Dirent: fuseutil.Dirent{
+			Name:  name,
+			Type:  fuseutil.DT_File,
+			Inode: d.cfg.inode(p),
+		},
+		Seed:     d.cfg.seedForPath(d.seed, "file", p),
+		Size:     size,
+		BaseSize: size,
+	}
+	entry.ContentSeed = entry.Seed
+
+	d.cfg.duplicateFile(&entry)
+	return entry
+}
+
+// reindex updates the offsets of all entries and the index of names.
+func (d *Dir) reindex() {
+	d.names = make(map[string]int, len(d.entries))
+	for i := range d.entries {
+		d.entries[i].Offset = fuseops.DirOffset(i + 1)
+		d.names[d.entries[i].Name] = i
+	}
+}
+
+func (d Dir) String() string {
+	return fmt.Sprintf("<Dir %v [seed %v]>", d.path, d.seed)
+}
+
+// Path returns the path of the directory within the tree.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Entries returns all entries of the directory.
+func (d *Dir) Entries() []DirEntry {
+	return d.entries
+}
+
+// Xattrs returns the extended attributes of the directory.
+func (d *Dir) Xattrs() []Xattr {
+	return d.cfg.xattrs(d.seed)
+}
+
+// EntryAttributes returns the attributes of entry. For subdirectories, the
+// directory is generated.
+func (d *Dir) EntryAttributes(entry DirEntry) fuseops.InodeAttributes {
+	if entry.Type == fuseutil.DT_Directory {
+		return d.Subdir(entry).Attributes()
+	}
+
+	return d.cfg.entryAttributes(entry)
+}
+
+// EntryXattrs returns the extended attributes of entry. Only files and
+// directories have extended attributes.
+func (d *Dir) EntryXattrs(entry DirEntry) []Xattr {
+	if entry.Type != fuseutil.DT_File && entry.Type != fuseutil.DT_Directory {
+		return nil
+	}
+
+	return d.cfg.xattrs(entry.Seed)
+}
+
+// inode returns the inode for a given file name.
+func (d Dir) inode(name string) fuseops.InodeID {
+	return d.cfg.inode(path.Join(d.path, name))
+}
+
+// Lookup returns the entry with the given name.
+func (d *Dir) Lookup(name string) (DirEntry, bool) {
+	i, ok := d.names[name]
+	if !ok {
+		return DirEntry{}, false
+	}
+
+	return d.entries[i], true
+}
+
+// Subdir generates the subdirectory for entry.
+func (d *Dir) Subdir(entry DirEntry) *Dir {
+	p := path.Join(d.path, entry.Name)
+	if entry.fixed != nil && entry.fixed.node != nil {
+		node := entry.fixed.node
+		return newDir(node.cfg, node, entry.Seed, p, node.depth)
+	}
+
+	return newDir(d.cfg, nil, entry.Seed, p, d.depth-1)
+}
+
+// File generates the file for entry, including all changes.
+func (d *Dir) File(entry DirEntry) *File {
+	f := NewFile(entry.ContentSeed, entry.BaseSize, entry.Inode)
+	f.Format = d.cfg.format()
+	kind := d.cfg.contentKind(entry.ContentSeed)
+	if entry.fixed != nil && entry.fixed.hasContent {
+		kind = entry.fixed.content
+	}
+
+	f.SetContent(kind, d.cfg.Compressibility)
+	d.cfg.shareSegments(f)
+	d.cfg.punchHoles(f)
+	for _, c := range entry.Changes {
+		f.Apply(c)
+	}
+
+	return f
+}
+
+// Walk calls fn for all entries of d and its subdirectories, depth first.
+func (d *Dir) Walk(fn func(dir *Dir, entry DirEntry) error) error {
+	for _, entry := range d.entries {
+		err := fn(d, entry)
+		if err != nil {
+			return err
+		}
+
+		if entry.Type == fuseutil.DT_Directory {
+			err = d.Subdir(entry).Walk(fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Attributes returns the attributes of the directory.
+func (d *Dir) Attributes() fuseops.InodeAttributes {
+	attr := d.cfg.dirAttributes(d.seed, d.modified)
+	if d.node != nil {
+		d.node.attrs.apply(&attr)
+	}
+	return attr
+}
+
+// ReadDir returns the entries of this directory.
+func (d Dir) ReadDir(dst []byte, offset int) (n int) {
+	for _, entry := range d.entries[offset:] {
+		written := fuseutil.WriteDirent(dst[n:], entry.Dirent)
+		if written == 0 {
+			break
+		}
+
+		n += written
+	}
+
+	return n
+}
@@ -0,0 +1,51 @@
+package fakedata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func TestNestedDirsDeterministic(t *testing.T) {
+	var compare func(d1, d2 *Dir)
+	compare = func(d1, d2 *Dir) {
+		if !reflect.DeepEqual(d1.entries, d2.entries) {
+			t.Fatalf("entries of %v differ", d1)
+		}
+
+		for _, entry := range d1.entries {
+			if entry.Type == fuseutil.DT_Directory {
+				compare(d1.Subdir(entry), d2.Subdir(entry))
+				continue
+			}
+
+			f1, f2 := d1.File(entry), d2.File(entry)
+			if !reflect.DeepEqual(f1.Segments, f2.Segments) {
+				t.Errorf("segments of %v differ", f1)
+			}
+		}
+	}
+
+	cfg := Config{Seed: 42, MaxSize: 1024, FilesPerDir: 4, DirsPerDir: 2, Depth: 3, Generation: 3, ChangeRate: 0.5}
+	compare(NewDir(&cfg, 42, "/", 3), NewDir(&cfg, 42, "/", 3))
+}
+
+func TestSeedForPath(t *testing.T) {
+	for _, format := range []int{FormatV1, FormatV2, FormatV3} {
+		cfg := Config{FormatVersion: format}
+		s1, s2 := cfg.seedForPath(23, "file", "/foo"), cfg.seedForPath(42, "file", "/foo")
+
+		// before FormatV3, the seed only depends on the path
+		if format < FormatV3 {
+			if s1 != s2 || s1 != SeedForPath(0, "file", "/foo") {
+				t.Errorf("format %d: seed depends on the parent", format)
+			}
+			continue
+		}
+
+		if s1 == s2 {
+			t.Errorf("format %d: seed does not depend on the parent", format)
+		}
+	}
+}
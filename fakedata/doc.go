@@ -0,0 +1,13 @@
+// Package fakedata generates deterministic trees of fake data. A tree is
+// described by a Config, all directories, files and their content are
+// derived from the seed and generated on demand. The same Config always
+// yields the same tree, so it can be used in tests without storing any data:
+//
+//	tree := fakedata.NewTree(fakedata.Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 10, DirsPerDir: 2, Depth: 2})
+//	err := tree.Walk(func(p string, fi fakedata.FileInfo) error {
+//		...
+//	})
+//	rd, err := tree.Open("/dir-4280805626115418960/file-1928224873444564195")
+//
+// The fakedatafs command serves the tree via FUSE.
+package fakedata
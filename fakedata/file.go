@@ -1,10 +1,11 @@
-package main
+package fakedata
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 
 	"github.com/jacobsa/fuse/fuseops"
@@ -17,10 +18,24 @@ const maxSegmentSize = 4 * 1024 * 1024 // 4MiB
 type Segment struct {
 	Seed int64
 	Size int
+
+	// Offset is the position within the data generated for Seed at which
+	// the segment starts.
+	Offset int64
+
+	// Hole is true if the segment is a hole in a sparse file, which only
+	// contains null bytes and has no data allocated.
+	Hole bool
+
+	// Format is the version of the format of the content, zero selects
+	// LatestFormat.
+	Format          int
+	Content         ContentKind
+	Compressibility float64
 }
 
 func (s Segment) String() string {
-	return fmt.Sprintf("<Segment seed 0x%x, len %v>", s.Seed, s.Size)
+	return fmt.Sprintf("<Segment seed 0x%x, len %v, %v>", s.Seed, s.Size, s.Content)
 }
 
 type randReader struct {
@@ -103,9 +118,27 @@ func (rd *randReader) Read(p []byte) (int, error) {
 	return pos, nil
 }
 
+// generator returns the generator for the content of the segment.
+func (s Segment) generator() io.ReaderAt {
+	if s.Hole {
+		return zeroReader{}
+	}
+
+	return formatGenerator(s.Format, s.Content, s.Seed, s.Compressibility)
+}
+
 // Reader returns a reader for this segment.
 func (s Segment) Reader() io.Reader {
-	return io.LimitReader(newRandReader(rand.New(rand.NewSource(s.Seed))), int64(s.Size))
+	return s.readerFrom(0)
+}
+
+// readerFrom returns a reader for the segment starting at off.
+func (s Segment) readerFrom(off int64) io.Reader {
+	if s.Hole {
+		return io.LimitReader(zeroReader{}, int64(s.Size)-off)
+	}
+
+	return io.LimitReader(contentStream(s.Format, s.Content, s.Seed, s.Compressibility, s.Offset+off), int64(s.Size)-off)
 }
 
 // File represents fake data with a specific seed.
@@ -115,6 +148,12 @@ type File struct {
 	Inode    fuseops.InodeID
 	Segments []Segment
 
+	// Format, Content and Compressibility select the generator for new
+	// segments, see Segment.
+	Format          int
+	Content         ContentKind
+	Compressibility float64
+
 	pos int64
 }
 
@@ -122,17 +161,40 @@ func (f File) String() string {
 	return fmt.Sprintf("<File seed 0x%x, Size %d>", f.Seed, f.Size)
 }
 
+// Fingerprint returns a hash of everything the content of the file is
+// generated from, without generating the content. Files with the same
+// fingerprint have the same content.
+func (f File) Fingerprint() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d", f.Size)
+	for _, s := range f.Segments {
+		format := s.Format
+		if format == 0 {
+			format = LatestFormat
+		}
+		fmt.Fprintf(hash, "|%d/%x/%d/%d/%t/%d/%v", format, uint64(s.Seed), s.Offset, s.Size, s.Hole, s.Content, s.Compressibility)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
 // NewFile initializes a new file with the given seed.
 func NewFile(seed int64, size int, inode fuseops.InodeID) *File {
-	f := &File{
-		Seed:  seed,
-		Inode: inode,
+	return &File{
+		Seed:     seed,
+		Size:     size,
+		Inode:    inode,
+		Segments: newSegments(seed, size),
 	}
+}
 
+// newSegments splits size bytes into segments of random length.
+func newSegments(seed int64, size int) (segments []Segment) {
 	src := rand.New(rand.NewSource(seed))
 	var segmentIndex int64
-	for f.Size < size {
-		nextSize := size - f.Size
+	pos := 0
+	for pos < size {
+		nextSize := size - pos
 		if nextSize > minSegmentSize {
 			max := nextSize - minSegmentSize
 			if max > maxSegmentSize {
@@ -145,13 +207,13 @@ func NewFile(seed int64, size int, inode fuseops.InodeID) *File {
 			Seed: seed ^ segmentIndex,
 			Size: nextSize,
 		}
-		f.Segments = append(f.Segments, segment)
+		segments = append(segments, segment)
 
-		f.Size += nextSize
+		pos += nextSize
 		segmentIndex++
 	}
 
-	return f
+	return segments
 }
 
 // ReadAll returns the content of the file.
@@ -195,21 +257,12 @@ func (f File) ReadAt(p []byte, off int64) (n int, err error) {
 			maxRead = len(p)
 		}
 
-		rd := seg.Reader()
-		if off > 0 {
-			_, err = io.CopyN(ioutil.Discard, rd, off)
-			if err != nil {
-				return 0, err
-			}
-
-			off = 0
-		}
-
-		n, err := io.ReadFull(rd, p[pos:maxRead])
+		n, err := seg.generator().ReadAt(p[pos:maxRead], seg.Offset+off)
 		pos += n
 		if err != nil {
 			return pos, err
 		}
+		off = 0
 
 		if pos == len(p) {
 			break
@@ -219,7 +272,70 @@ func (f File) ReadAt(p []byte, off int64) (n int, err error) {
 	return pos, nil
 }
 
-// Seek to the given position.
+// parallelChunkSize is the size of the parts of a read which are generated
+// concurrently by ReadAtParallel.
+const parallelChunkSize = 1 << 20
+
+// ReadAtParallel is like ReadAt, but generates the content with up to workers
+// goroutines for reads larger than 2MiB. The content is the same as returned
+// by ReadAt. Files in FormatV1 are always read sequentially.
+func (f File) ReadAtParallel(p []byte, off int64, workers int) (int, error) {
+	if workers <= 1 || f.Format == FormatV1 || len(p) < 2*parallelChunkSize || off < 0 || off > int64(f.Size) {
+		return f.ReadAt(p, off)
+	}
+
+	if rest := int64(f.Size) - off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	chunks := (len(p) + parallelChunkSize - 1) / parallelChunkSize
+	if workers > chunks {
+		workers = chunks
+	}
+
+	ch := make(chan int)
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			var err error
+			for chunk := range ch {
+				if err != nil {
+					continue
+				}
+
+				start := chunk * parallelChunkSize
+				end := start + parallelChunkSize
+				if end > len(p) {
+					end = len(p)
+				}
+
+				_, err = f.ReadAt(p[start:end], off+int64(start))
+			}
+			errs <- err
+		}()
+	}
+
+	for chunk := 0; chunk < chunks; chunk++ {
+		ch <- chunk
+	}
+	close(ch)
+
+	var err error
+	for i := 0; i < workers; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Seek to the given position. Apart from the usual values for whence,
+// SeekData and SeekHole are supported.
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	pos := f.pos
 	switch whence {
@@ -229,6 +345,12 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 		pos += offset
 	case 2:
 		pos = int64(f.Size) - offset
+	case SeekData, SeekHole:
+		var err error
+		pos, err = f.seekHole(offset, whence == SeekHole)
+		if err != nil {
+			return 0, err
+		}
 	}
 	if pos < 0 {
 		return 0, errors.New("invalid negative position in file")
@@ -276,19 +398,10 @@ func (rd *contFileReader) Read(p []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	// skip bytes of current reader
+	// start the current reader at the remaining offset
 	if rd.cur == nil {
-		seg := rd.Segments[rd.seg]
-		rd.cur = seg.Reader()
-
-		if rd.skip > 0 {
-			_, err := io.CopyN(ioutil.Discard, rd.cur, rd.skip)
-			if err != nil {
-				return 0, err
-			}
-
-			rd.skip = 0
-		}
+		rd.cur = rd.Segments[rd.seg].readerFrom(rd.skip)
+		rd.skip = 0
 	}
 
 	// read data
@@ -297,7 +410,8 @@ func (rd *contFileReader) Read(p []byte) (int, error) {
 		n, err := io.ReadFull(rd.cur, p[pos:])
 		pos += n
 
-		if err == io.ErrUnexpectedEOF {
+		// the segment may also end exactly where the previous read stopped
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
 			rd.seg++
 			if rd.seg >= len(rd.Segments) {
 				rd.cur = nil
@@ -1,7 +1,8 @@
-package main
+package fakedata
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"math/rand"
 	"testing"
@@ -134,6 +135,42 @@ func TestSingleFile(t *testing.T) {
 	}
 }
 
+func TestFileReadAtParallel(t *testing.T) {
+	f := NewFile(23, 20<<20+123, 0)
+	f.SetContent(ContentMixed, 0.5)
+
+	want, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		off, size int
+	}{
+		{0, len(want)},
+		{12345, 5 << 20},
+		{len(want) - 3<<20, 5 << 20},
+		{len(want) - 100, 100},
+	} {
+		for _, workers := range []int{0, 1, 3, 8} {
+			buf := make([]byte, test.size)
+			n, err := f.ReadAtParallel(buf, int64(test.off), workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantN := len(want) - test.off
+			if wantN > test.size {
+				wantN = test.size
+			}
+
+			if n != wantN || !bytes.Equal(buf[:n], want[test.off:test.off+n]) {
+				t.Errorf("offset %v, size %v, %d workers: wrong data returned (%d bytes)", test.off, test.size, workers, n)
+			}
+		}
+	}
+}
+
 func TestRandReader(t *testing.T) {
 	rd := newRandReader(rand.New(rand.NewSource(23)))
 
@@ -338,6 +375,42 @@ func BenchmarkFileReadContinousReadLatency(t *testing.B) {
 	}
 }
 
+func BenchmarkFileReadAtEndOfSegment(t *testing.B) {
+	f := NewFile(42, 1<<28, 0)
+	seg := f.Segments[0]
+	buf := make([]byte, 4096)
+
+	t.SetBytes(int64(len(buf)))
+	t.ResetTimer()
+
+	for i := 0; i < t.N; i++ {
+		_, err := f.ReadAt(buf, int64(seg.Size-len(buf)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileReadAtParallel(b *testing.B) {
+	f := NewFile(42, 1<<28, 0)
+	buf := make([]byte, 32<<20)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				off := int64(i%8) * int64(len(buf))
+				_, err := f.ReadAtParallel(buf, off, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkFileReadAtAll(t *testing.B) {
 	filesize := 1 << 28
 
@@ -0,0 +1,181 @@
+package fakedata
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+)
+
+// These are the versions of the format of the generated data. For a format
+// version, the same configuration always generates the same tree with the
+// same data, in all releases and with all Go versions. When the generator is
+// changed in a way which changes the data, a new version is added and the
+// old versions are kept.
+const (
+	// FormatV1 generates the content with math/rand. Reading at an offset
+	// within a segment needs to generate all data before it. Inodes are 32
+	// bit, so they collide in large trees.
+	FormatV1 = 1
+
+	// FormatV2 generates the content in counter mode, so the data at any
+	// offset can be generated directly. Inodes are still 32 bit.
+	FormatV2 = 2
+
+	// FormatV3 uses 63 bit inodes, which practically never collide. The
+	// seeds of entries depend on the seed of the directory, and duplicate
+	// files only share the content, not the metadata.
+	FormatV3 = 3
+
+	// LatestFormat is used when no format version is selected.
+	LatestFormat = FormatV3
+)
+
+// CheckFormat returns an error if version is not a known format version or
+// zero, which selects LatestFormat.
+func CheckFormat(version int) error {
+	if version < 0 || version > LatestFormat {
+		return fmt.Errorf("unknown format version %d, supported are %d to %d", version, FormatV1, LatestFormat)
+	}
+
+	return nil
+}
+
+// format returns the format version selected in the configuration.
+func (cfg *Config) format() int {
+	if cfg.FormatVersion == 0 {
+		return LatestFormat
+	}
+
+	return cfg.FormatVersion
+}
+
+// contentStream returns an endless reader for the content starting at off.
+// For FormatV1, the data before off is generated and discarded. A format of
+// zero selects LatestFormat.
+func contentStream(format int, kind ContentKind, seed int64, compressibility float64, off int64) io.Reader {
+	if format == FormatV1 {
+		rd := contentReaderV1(kind, seed, compressibility)
+		if off > 0 {
+			// the reader never fails
+			_, _ = io.CopyN(ioutil.Discard, rd, off)
+		}
+		return rd
+	}
+
+	return io.NewSectionReader(contentGenerator(kind, seed, compressibility), off, math.MaxInt64-off)
+}
+
+// formatGenerator returns the generator for content of kind in format.
+func formatGenerator(format int, kind ContentKind, seed int64, compressibility float64) io.ReaderAt {
+	if format == FormatV1 {
+		return generatorV1{kind: kind, seed: seed, compressibility: compressibility}
+	}
+
+	return contentGenerator(kind, seed, compressibility)
+}
+
+// generatorV1 implements io.ReaderAt for FormatV1 by generating the data up
+// to the offset.
+type generatorV1 struct {
+	kind            ContentKind
+	seed            int64
+	compressibility float64
+}
+
+func (g generatorV1) ReadAt(p []byte, off int64) (int, error) {
+	return io.ReadFull(contentStream(FormatV1, g.kind, g.seed, g.compressibility, off), p)
+}
+
+// contentReaderV1 returns an endless reader for content of kind with seed in
+// FormatV1. The zero and pattern content is the same as for FormatV2.
+func contentReaderV1(kind ContentKind, seed int64, compressibility float64) io.Reader {
+	rnd := rand.New(rand.NewSource(seed))
+	switch kind {
+	case ContentZero:
+		return zeroReader{}
+	case ContentPattern:
+		return io.NewSectionReader(newPatternGenerator(seed), 0, math.MaxInt64)
+	case ContentText:
+		return &textReaderV1{rnd: rnd}
+	case ContentCompressible:
+		return newCompressibleReaderV1(rnd, compressibility)
+	}
+
+	return newRandReader(rnd)
+}
+
+type textReaderV1 struct {
+	rnd *rand.Rand
+	buf []byte
+}
+
+// line appends a line of random words to the buffer.
+func (rd *textReaderV1) line() {
+	n := 5 + rd.rnd.Intn(10)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			rd.buf = append(rd.buf, ' ')
+		}
+		rd.buf = append(rd.buf, words[rd.rnd.Intn(len(words))]...)
+	}
+	rd.buf = append(rd.buf, '\n')
+}
+
+func (rd *textReaderV1) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(rd.buf) == 0 {
+			rd.line()
+		}
+
+		c := copy(p[n:], rd.buf)
+		n += c
+		rd.buf = rd.buf[:copy(rd.buf, rd.buf[c:])]
+	}
+
+	return n, nil
+}
+
+type compressibleReaderV1 struct {
+	rd     io.Reader
+	random int
+	block  [compressibleBlockSize]byte
+	pos    int
+}
+
+func newCompressibleReaderV1(rnd *rand.Rand, compressibility float64) io.Reader {
+	random := int((1-compressibility)*compressibleBlockSize + 0.5)
+	random = clamp(random, 0, compressibleBlockSize)
+
+	return &compressibleReaderV1{
+		rd:     newRandReader(rnd),
+		random: random,
+		pos:    compressibleBlockSize,
+	}
+}
+
+func (rd *compressibleReaderV1) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if rd.pos == len(rd.block) {
+			_, err := io.ReadFull(rd.rd, rd.block[:rd.random])
+			if err != nil {
+				return n, err
+			}
+
+			for i := rd.random; i < len(rd.block); i++ {
+				rd.block[i] = 0
+			}
+
+			rd.pos = 0
+		}
+
+		c := copy(p[n:], rd.block[rd.pos:])
+		n += c
+		rd.pos += c
+	}
+
+	return n, nil
+}
@@ -0,0 +1,204 @@
+package fakedata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// goldenConfig returns the configuration for the golden test vectors, it
+// uses most features of the generator.
+func goldenConfig() Config {
+	return Config{
+		Seed:            42,
+		MaxSize:         1 << 20,
+		FilesPerDir:     8,
+		DirsPerDir:      2,
+		Depth:           2,
+		SymlinksPerDir:  1,
+		HardlinksPerDir: 1,
+		SpecialPerDir:   1,
+		Contents:        []ContentKind{ContentRandom, ContentZero, ContentPattern, ContentText, ContentCompressible, ContentMixed},
+		Compressibility: 0.5,
+		DupRate:         0.3,
+		DupFileRate:     0.1,
+		DupPoolSize:     5,
+		DupUnaligned:    0.5,
+		SparseRate:      0.3,
+		HoleRate:        0.5,
+		Generation:      2,
+		ChangeRate:      0.3,
+		MtimeMin:        time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		MtimeMax:        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Uids:            IDs{{0, 0}, {1000, 1000}},
+		Gids:            IDs{{0, 0}, {100, 100}},
+		SpecialBitsRate: 0.1,
+		XattrsPerFile:   2,
+		XattrMaxSize:    64,
+		CapabilityRate:  0.2,
+		ACLRate:         0.2,
+	}
+}
+
+// treeDigest returns a hash of the metadata, extended attributes and content
+// of all entries of the tree.
+func treeDigest(t testing.TB, tree *Tree) string {
+	hash := sha256.New()
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		attr := fi.attr
+		fmt.Fprintf(hash, "%s %v %d %d %d %d %d %d %q\n", p, fi.Mode(), fi.Size(), fi.ModTime().UnixNano(),
+			attr.Uid, attr.Gid, attr.Nlink, fi.Inode(), fi.Target())
+
+		d, err := tree.OpenDir(path.Dir(p))
+		if err != nil {
+			return err
+		}
+
+		for _, x := range d.EntryXattrs(fi.entry) {
+			fmt.Fprintf(hash, "  xattr %s %x\n", x.Name, x.Value)
+		}
+
+		if fi.entry.Type == fuseutil.DT_File {
+			buf, err := d.File(fi.entry).ReadAll()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "  content %x\n", sha256.Sum256(buf))
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// fileDigest returns the SHA-256 hash of the content of f.
+func fileDigest(t testing.TB, f *File) string {
+	buf, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// goldenFiles are the hashes of files with seed 23 and 9MiB+123 bytes. The
+// values must never change, add a new format version instead.
+var goldenFiles = []struct {
+	format int
+	kind   ContentKind
+	sha256 string
+}{
+	{FormatV1, ContentRandom, "dfc962d68739a0f292da681ce995208c7e56b19efc02c9cbd3d918b7f9bc0001"},
+	{FormatV1, ContentZero, "a9a12a08a5c6935871a79c777c468692624f909a658bcc1d2fec2ccddac5ea75"},
+	{FormatV1, ContentPattern, "6c8a5f2975617688a54fca5051fda0580fc02a1ee55f6e66283a6c998993319c"},
+	{FormatV1, ContentText, "a6ed011dec253255aec0f7a5840acebc53494b3f78964f5053f011fdf5dbffaf"},
+	{FormatV1, ContentCompressible, "99c1ac3fc8a884fd4b830d584493b8d2cff2fe36005c304179970dbb5362047e"},
+	{FormatV1, ContentMixed, "7ced63b3f75c7a0a63845b30151a748ac003ec26b589f846b7288e4b7b386bc7"},
+
+	{FormatV2, ContentRandom, "ade2205514c6459203a2ec56d11aea48e63b084cce62a293a5462954038160a7"},
+	{FormatV2, ContentZero, "a9a12a08a5c6935871a79c777c468692624f909a658bcc1d2fec2ccddac5ea75"},
+	{FormatV2, ContentPattern, "6c8a5f2975617688a54fca5051fda0580fc02a1ee55f6e66283a6c998993319c"},
+	{FormatV2, ContentText, "049f19337e252e7f44c8b20d488bf9bfc3687084de99c8cf1ee79653d3863856"},
+	{FormatV2, ContentCompressible, "6a84f84c3de6211d51c4eaf34c5a05f3eb799c6ee7b8fbd8eeefbd2bbd59623e"},
+	{FormatV2, ContentMixed, "348e252bf3d3a4330b4cbbe541576afc3f9f83ac3ccbdad700768aaff9fb9744"},
+
+	{FormatV3, ContentRandom, "ade2205514c6459203a2ec56d11aea48e63b084cce62a293a5462954038160a7"},
+	{FormatV3, ContentZero, "a9a12a08a5c6935871a79c777c468692624f909a658bcc1d2fec2ccddac5ea75"},
+	{FormatV3, ContentPattern, "6c8a5f2975617688a54fca5051fda0580fc02a1ee55f6e66283a6c998993319c"},
+	{FormatV3, ContentText, "049f19337e252e7f44c8b20d488bf9bfc3687084de99c8cf1ee79653d3863856"},
+	{FormatV3, ContentCompressible, "6a84f84c3de6211d51c4eaf34c5a05f3eb799c6ee7b8fbd8eeefbd2bbd59623e"},
+	{FormatV3, ContentMixed, "348e252bf3d3a4330b4cbbe541576afc3f9f83ac3ccbdad700768aaff9fb9744"},
+}
+
+// goldenTrees are the digests of the tree for goldenConfig.
+var goldenTrees = []struct {
+	format int
+	digest string
+}{
+	{FormatV1, "e76dfc4bdf7bb7b2b4cf22408da0d66be31d412d6e3c5fcacee6f0d3deaf194b"},
+	{FormatV2, "e36ecd793505263f2297ce60098d3028b701b6b063a38a20730ba3c070b93b74"},
+	{FormatV3, "347b9898ec0ce92dd5a39816bdb58eff09f4522ce44dda150fa3b62daa36c57c"},
+}
+
+func TestGoldenFiles(t *testing.T) {
+	for _, test := range goldenFiles {
+		f := NewFile(23, 9<<20+123, 0)
+		f.Format = test.format
+		f.SetContent(test.kind, 0.5)
+
+		if digest := fileDigest(t, f); digest != test.sha256 {
+			t.Errorf("format %d, %v: wrong hash %v", test.format, test.kind, digest)
+		}
+	}
+}
+
+func TestGoldenTrees(t *testing.T) {
+	for _, test := range goldenTrees {
+		cfg := goldenConfig()
+		cfg.FormatVersion = test.format
+
+		if digest := treeDigest(t, NewTree(cfg)); digest != test.digest {
+			t.Errorf("format %d: wrong digest %v", test.format, digest)
+		}
+	}
+
+	if len(goldenTrees) != LatestFormat {
+		t.Fatalf("golden test vectors for format %d missing", LatestFormat)
+	}
+
+	// without a format version, the latest is used
+	if digest := treeDigest(t, NewTree(goldenConfig())); digest != goldenTrees[LatestFormat-1].digest {
+		t.Errorf("default format is not the latest format")
+	}
+}
+
+func TestFormatV1ReadAt(t *testing.T) {
+	f := NewFile(23, 9<<20+123, 0)
+	f.Format = FormatV1
+	f.SetContent(ContentMixed, 0.5)
+
+	want, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := NewFileReader(f)
+	rd.Workers = 4
+	for _, off := range []int64{0, 1000, 5<<20 + 17, int64(len(want)) - 3<<20} {
+		buf := make([]byte, 3<<20)
+		n, err := rd.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf[:n], want[off:off+int64(n)]) {
+			t.Errorf("wrong data at offset %v", off)
+		}
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	for _, version := range []int{0, FormatV1, FormatV2, FormatV3, LatestFormat} {
+		if err := CheckFormat(version); err != nil {
+			t.Errorf("format %d rejected: %v", version, err)
+		}
+	}
+
+	for _, version := range []int{-1, LatestFormat + 1} {
+		if err := CheckFormat(version); err == nil {
+			t.Errorf("format %d accepted", version)
+		}
+	}
+}
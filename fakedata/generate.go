@@ -0,0 +1,266 @@
+package fakedata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// treeItem is an entry of the tree passed to a TreeWriter.
+type treeItem struct {
+	// Path is the path of the entry relative to the root of the tree,
+	// without a leading slash.
+	Path string
+
+	Type   fuseutil.DirentType
+	Inode  fuseops.InodeID
+	Attr   fuseops.InodeAttributes
+	Xattrs []Xattr
+
+	// File is the content of a regular file.
+	File *File
+
+	// Target is the target of a symlink.
+	Target string
+}
+
+// TreeWriter writes the entries of a tree somewhere.
+type TreeWriter interface {
+	// Write writes the entry item. Directories are written before their
+	// entries, all names of a file with hardlinks have the same inode.
+	Write(item treeItem) error
+
+	// Close finishes writing the tree.
+	Close() error
+}
+
+// WriteTree writes all entries of the tree below root to w.
+func WriteTree(root *Dir, w TreeWriter) error {
+	err := root.Walk(func(d *Dir, entry DirEntry) error {
+		item := treeItem{
+			Path:   path.Join(d.path, entry.Name)[1:],
+			Type:   entry.Type,
+			Inode:  entry.Inode,
+			Target: entry.Target,
+			Xattrs: d.cfg.xattrs(entry.Seed),
+		}
+
+		switch entry.Type {
+		case fuseutil.DT_Directory:
+			item.Attr = d.Subdir(entry).Attributes()
+		case fuseutil.DT_File:
+			item.Attr = d.cfg.entryAttributes(entry)
+			item.File = d.File(entry)
+		default:
+			item.Attr = d.cfg.entryAttributes(entry)
+			item.Xattrs = nil
+		}
+
+		return w.Write(item)
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// unixMode returns the mode in the format used by stat(2).
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+
+	switch {
+	case mode.IsDir():
+		m |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		m |= syscall.S_IFLNK
+	case mode&os.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		m |= syscall.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	default:
+		m |= syscall.S_IFREG
+	}
+
+	return m
+}
+
+// DirWriter writes a tree to a directory. Holes in sparse files are kept.
+type DirWriter struct {
+	// Root is the directory the tree is written to.
+	Root string
+
+	// Owner sets the user and group IDs, Xattrs sets the extended attributes.
+	Owner  bool
+	Xattrs bool
+
+	// Warn is called for entries which cannot be created, e.g. devices
+	// when not running as root. If it is nil, an error is returned instead.
+	Warn func(p string, err error)
+
+	// Workers is the number of goroutines generating the content of large
+	// files, see FileReader.Workers.
+	Workers int
+
+	// links maps the inodes of files with several names to the first name,
+	// dirs are the directories which need their attributes set at the end.
+	links map[fuseops.InodeID]string
+	dirs  []treeItem
+}
+
+// Write creates the entry item.
+func (w *DirWriter) Write(item treeItem) error {
+	filename := filepath.Join(w.Root, filepath.FromSlash(item.Path))
+
+	var err error
+	switch item.Type {
+	case fuseutil.DT_Directory:
+		err = os.Mkdir(filename, 0700)
+		if err == nil {
+			// directories may be read-only, change the mode after the
+			// entries have been created
+			w.dirs = append(w.dirs, item)
+			return w.setXattrs(filename, item)
+		}
+	case fuseutil.DT_File:
+		if item.Attr.Nlink > 1 {
+			if w.links == nil {
+				w.links = make(map[fuseops.InodeID]string)
+			}
+
+			if first, ok := w.links[item.Inode]; ok {
+				return os.Link(first, filename)
+			}
+			w.links[item.Inode] = filename
+		}
+
+		err = writeFile(filename, item.File, w.Workers)
+	case fuseutil.DT_Link:
+		err = os.Symlink(item.Target, filename)
+		if err == nil && w.Owner {
+			err = os.Lchown(filename, int(item.Attr.Uid), int(item.Attr.Gid))
+		}
+		return err
+	default:
+		err = syscall.Mknod(filename, unixMode(item.Attr.Mode), 0)
+		if err != nil && w.Warn != nil {
+			w.Warn(item.Path, err)
+			return nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = w.setXattrs(filename, item)
+	if err != nil {
+		return err
+	}
+
+	return w.setAttributes(filename, item)
+}
+
+// setXattrs sets the extended attributes of the file, if requested.
+func (w *DirWriter) setXattrs(filename string, item treeItem) error {
+	if !w.Xattrs {
+		return nil
+	}
+
+	for _, attr := range item.Xattrs {
+		err := setXattr(filename, attr.Name, attr.Value)
+		if err != nil {
+			return fmt.Errorf("%v: %v", item.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// setAttributes sets the ownership, mode and times of the file.
+func (w *DirWriter) setAttributes(filename string, item treeItem) error {
+	if w.Owner {
+		err := os.Lchown(filename, int(item.Attr.Uid), int(item.Attr.Gid))
+		if err != nil {
+			return err
+		}
+	}
+
+	// chown clears the setuid and setgid bits, so change the mode afterwards
+	err := os.Chmod(filename, item.Attr.Mode&PermBits)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(filename, item.Attr.Atime, item.Attr.Mtime)
+}
+
+// Close sets the attributes of all directories, starting with the innermost.
+func (w *DirWriter) Close() error {
+	for i := len(w.dirs) - 1; i >= 0; i-- {
+		item := w.dirs[i]
+		err := w.setAttributes(filepath.Join(w.Root, filepath.FromSlash(item.Path)), item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the content of f to the new file filename, generated by
+// workers goroutines. Holes are skipped, so that the file is sparse.
+func writeFile(filename string, f *File, workers int) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	rd := NewFileReader(f)
+	rd.Workers = workers
+
+	var off int64
+	for _, seg := range f.Segments {
+		if seg.Hole {
+			_, err = file.Seek(int64(seg.Size), io.SeekCurrent)
+		} else {
+			_, err = rd.Seek(off, io.SeekStart)
+			if err == nil {
+				_, err = io.CopyN(file, rd, int64(seg.Size))
+			}
+		}
+		off += int64(seg.Size)
+
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+
+	err = file.Truncate(int64(f.Size))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
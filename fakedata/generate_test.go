@@ -0,0 +1,202 @@
+package fakedata
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func newGenerateTestDir() *Dir {
+	cfg := Config{
+		Seed: 23, MaxSize: 256 * 1024, FilesPerDir: 5, DirsPerDir: 2, Depth: 1,
+		SymlinksPerDir: 2, HardlinksPerDir: 1, SparseRate: 0.5,
+		Modes: []os.FileMode{0644, 0600 | os.ModeSetuid},
+	}
+	return NewDir(&cfg, cfg.Seed, "/", cfg.Depth)
+}
+
+func TestGenerateDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakedatafs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := newGenerateTestDir()
+	err = WriteTree(root, &DirWriter{Root: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diffs := verifyTestTree(t, root, dir); len(diffs) != 0 {
+		t.Fatalf("unexpected differences %v", diffs)
+	}
+}
+
+// walkFiles returns the content of all regular files below d, by path.
+func walkFiles(t testing.TB, d *Dir) map[string][]byte {
+	files := make(map[string][]byte)
+	err := d.Walk(func(d *Dir, entry DirEntry) error {
+		if entry.Type != fuseutil.DT_File {
+			return nil
+		}
+
+		buf, err := d.File(entry).ReadAll()
+		if err != nil {
+			return err
+		}
+
+		files[path.Join(d.path, entry.Name)[1:]] = buf
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestGenerateTar(t *testing.T) {
+	root := newGenerateTestDir()
+	want := walkFiles(t, root)
+
+	buf := bytes.NewBuffer(nil)
+	err := WriteTree(root, NewTarWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := 0
+	seen := make(map[string]bool)
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(data, want[hdr.Name]) {
+				t.Errorf("wrong content for %v", hdr.Name)
+			}
+			seen[hdr.Name] = true
+		case tar.TypeLink:
+			if !bytes.Equal(want[hdr.Name], want[hdr.Linkname]) {
+				t.Errorf("%v is not a hardlink of %v", hdr.Name, hdr.Linkname)
+			}
+			seen[hdr.Name] = true
+			links++
+		}
+	}
+
+	if len(seen) != len(want) {
+		t.Errorf("found %d files in the archive, want %d", len(seen), len(want))
+	}
+
+	if links == 0 {
+		t.Errorf("no hardlinks found in the archive")
+	}
+}
+
+func TestGenerateTarSameInode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewTarWriter(buf)
+
+	// files with the same inode are only hardlinks if the link count says so
+	for _, name := range []string{"a", "b"} {
+		item := treeItem{Path: name, Type: fuseutil.DT_File, Inode: 23, File: NewFile(23, 100, 23)}
+		item.Attr.Nlink = 1
+		err := w.Write(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			t.Errorf("%v: wrong type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func TestGenerateCpio(t *testing.T) {
+	root := newGenerateTestDir()
+	want := walkFiles(t, root)
+
+	buf := bytes.NewBuffer(nil)
+	err := WriteTree(root, NewCpioWriter(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	field := func(hdr []byte, i int) int {
+		v, err := strconv.ParseUint(string(hdr[6+8*i:14+8*i]), 16, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(v)
+	}
+	align := func(n int) int {
+		return (n + 3) &^ 3
+	}
+
+	seen := 0
+	for {
+		if len(data) < 110 || string(data[:6]) != "070701" {
+			t.Fatalf("invalid header")
+		}
+
+		namesize, size := field(data, 11), field(data, 6)
+		name := string(data[110 : 110+namesize-1])
+		if name == cpioTrailer {
+			break
+		}
+
+		data = data[align(110+namesize):]
+
+		// the data of a file with hardlinks is stored with the last name
+		if content, ok := want[name]; ok && size > 0 {
+			if !bytes.Equal(data[:size], content) {
+				t.Errorf("wrong content for %v", name)
+			}
+			seen++
+		}
+
+		data = data[align(size):]
+	}
+
+	if seen == 0 || seen > len(want) {
+		t.Errorf("found %d files with content, want at most %d", seen, len(want))
+	}
+}
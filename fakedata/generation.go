@@ -0,0 +1,161 @@
+package fakedata
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strconv"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// ChangeKind describes how a file was changed in a generation.
+type ChangeKind int
+
+// These are the possible kinds of changes to a file.
+const (
+	ChangeModify ChangeKind = iota
+	ChangeAppend
+	ChangeTruncate
+	ChangeDelete
+	// ChangeTouch only updates the modification time of a file.
+	ChangeTouch
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeModify:
+		return "modify"
+	case ChangeAppend:
+		return "append"
+	case ChangeTruncate:
+		return "truncate"
+	case ChangeDelete:
+		return "delete"
+	case ChangeTouch:
+		return "touch"
+	}
+
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a modification of a file in a generation.
+type Change struct {
+	Generation int
+	Kind       ChangeKind
+	Seed       int64
+
+	// Size is the number of bytes appended for ChangeAppend and the new size
+	// for ChangeTruncate.
+	Size int
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("<Change %v in generation %d, seed 0x%x, size %d>", c.Kind, c.Generation, c.Seed, c.Size)
+}
+
+// createRate is the fraction of ChangeRate used to determine the number of
+// new files in a directory per generation.
+const createRate = 0.2
+
+// applyGeneration changes the entries of d for generation gen: files are
+// modified, appended to, truncated, deleted and created.
+func (d *Dir) applyGeneration(gen int) {
+	rate := d.cfg.ChangeRate
+	if rate <= 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(d.cfg.seedForPath(d.seed, "generation", path.Join(d.path, strconv.Itoa(gen)))))
+
+	entries := d.entries[:0]
+	changed := false
+	for _, entry := range d.entries {
+		if entry.Type != fuseutil.DT_File || rnd.Float64() >= rate {
+			entries = append(entries, entry)
+			continue
+		}
+
+		c := Change{
+			Generation: gen,
+			Kind:       ChangeKind(rnd.Intn(int(ChangeDelete) + 1)),
+			Seed:       rnd.Int63(),
+		}
+
+		switch c.Kind {
+		case ChangeDelete:
+			debugf("generation %d: delete %v\n", gen, path.Join(d.path, entry.Name))
+			changed = true
+			continue
+		case ChangeAppend:
+			c.Size = 1 + rnd.Intn(d.cfg.MaxSize/2+1)
+			entry.Size += c.Size
+		case ChangeTruncate:
+			c.Size = rnd.Intn(entry.Size + 1)
+			entry.Size = c.Size
+		}
+
+		entry.Changes = append(entry.Changes, c)
+		entry.Modified = gen
+		entries = append(entries, entry)
+	}
+	d.entries = entries
+
+	for i := 0; i < d.cfg.FilesPerDir; i++ {
+		if rnd.Float64() >= rate*createRate {
+			continue
+		}
+
+		entry := d.newFile(fmt.Sprintf("file-%d", rnd.Int()), d.cfg.size(rnd))
+		entry.Created = gen
+		entry.Modified = gen
+		debugf("generation %d: create %v\n", gen, path.Join(d.path, entry.Name))
+		d.entries = append(d.entries, entry)
+		changed = true
+	}
+
+	if changed {
+		d.modified = gen
+	}
+
+	d.reindex()
+}
+
+// Apply changes the segments of the file according to c. For ChangeModify,
+// only some of the segments get new content, so that programs which detect
+// duplicate data will find the other segments.
+func (f *File) Apply(c Change) {
+	switch c.Kind {
+	case ChangeModify:
+		if len(f.Segments) == 0 {
+			return
+		}
+
+		rnd := rand.New(rand.NewSource(c.Seed))
+		n := 1 + rnd.Intn((len(f.Segments)+1)/2)
+		for _, i := range rnd.Perm(len(f.Segments))[:n] {
+			f.Segments[i].Seed = c.Seed ^ int64(i)
+			f.Segments[i].Offset = 0
+			f.Segments[i].Hole = false
+		}
+	case ChangeAppend:
+		segments := newSegments(c.Seed, c.Size)
+		f.setSegmentContent(segments)
+		f.Segments = append(f.Segments, segments...)
+		f.Size += c.Size
+	case ChangeTruncate:
+		size := 0
+		for i, seg := range f.Segments {
+			if size+seg.Size >= c.Size {
+				f.Segments[i].Size = c.Size - size
+				f.Segments = f.Segments[:i+1]
+				if f.Segments[i].Size == 0 {
+					f.Segments = f.Segments[:i]
+				}
+				break
+			}
+			size += seg.Size
+		}
+		f.Size = c.Size
+	}
+}
@@ -0,0 +1,111 @@
+package fakedata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerations(t *testing.T) {
+	cfg0 := Config{Seed: 23, MaxSize: 3 << 20, FilesPerDir: 100}
+	cfg1 := cfg0
+	cfg1.Generation = 1
+	cfg1.ChangeRate = 0.5
+
+	d0 := NewDir(&cfg0, 23, "/", 0)
+	d1 := NewDir(&cfg1, 23, "/", 0)
+
+	kinds := make(map[ChangeKind]int)
+	for _, e0 := range d0.entries {
+		e1, ok := d1.Lookup(e0.Name)
+		if !ok {
+			kinds[ChangeDelete]++
+			continue
+		}
+
+		buf0, err := d0.File(e0).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf1, err := d1.File(e1).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(buf1) != e1.Size {
+			t.Errorf("%v: size %d does not match content length %d", e1.Name, e1.Size, len(buf1))
+		}
+
+		if len(e1.Changes) == 0 {
+			if !bytes.Equal(buf0, buf1) {
+				t.Errorf("%v: content changed without change", e1.Name)
+			}
+
+			if e1.Modified != 0 {
+				t.Errorf("%v: unchanged file has modification generation %d", e1.Name, e1.Modified)
+			}
+			continue
+		}
+
+		c := e1.Changes[0]
+		kinds[c.Kind]++
+
+		mtime := cfg1.fileAttributes(e1).Mtime
+		if e1.Modified != 1 || mtime.Before(cfg1.generationTime(1)) || !mtime.Before(cfg1.generationTime(2)) {
+			t.Errorf("%v: wrong modification time for changed file", e1.Name)
+		}
+
+		switch c.Kind {
+		case ChangeAppend:
+			if !bytes.Equal(buf0, buf1[:len(buf0)]) {
+				t.Errorf("%v: prefix of appended file changed", e1.Name)
+			}
+		case ChangeTruncate:
+			if !bytes.Equal(buf0[:len(buf1)], buf1) {
+				t.Errorf("%v: truncated file is not a prefix of the original", e1.Name)
+			}
+		case ChangeModify:
+			if len(buf0) > 0 && bytes.Equal(buf0, buf1) {
+				t.Errorf("%v: modified file has same content", e1.Name)
+			}
+		}
+	}
+
+	created := 0
+	for _, e1 := range d1.entries {
+		if _, ok := d0.Lookup(e1.Name); !ok {
+			created++
+			if e1.Created != 1 {
+				t.Errorf("%v: new file has wrong creation generation %d", e1.Name, e1.Created)
+			}
+		}
+	}
+
+	for _, kind := range []ChangeKind{ChangeModify, ChangeAppend, ChangeTruncate, ChangeDelete} {
+		if kinds[kind] == 0 {
+			t.Errorf("no file with change %v found", kind)
+		}
+	}
+
+	if created == 0 {
+		t.Errorf("no new files created")
+	}
+}
+
+func TestFileModifyPartially(t *testing.T) {
+	size := 40 << 20
+	f0 := NewFile(23, size, 0)
+	f1 := NewFile(23, size, 0)
+	f1.Apply(Change{Kind: ChangeModify, Seed: 42})
+
+	same := 0
+	for i := range f0.Segments {
+		if f0.Segments[i] == f1.Segments[i] {
+			same++
+		}
+	}
+
+	if same == 0 || same == len(f0.Segments) {
+		t.Errorf("want some segments changed, got %d of %d unchanged", same, len(f0.Segments))
+	}
+}
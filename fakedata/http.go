@@ -0,0 +1,294 @@
+package fakedata
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jacobsa/fuse/fuseutil"
+	"golang.org/x/net/webdav"
+)
+
+// HTTPHandler serves a tree via HTTP. Files support range and conditional
+// requests, the ETag is the fingerprint of the file and Last-Modified its
+// modification time. For directories, a listing in HTML is returned.
+// Symlinks and special files are listed, but cannot be downloaded.
+type HTTPHandler struct {
+	Tree *Tree
+
+	// WebDAV enables read-only WebDAV access via OPTIONS and PROPFIND in
+	// addition to GET and HEAD.
+	WebDAV bool
+
+	// Workers is the number of goroutines generating the content of large
+	// and sequential reads, see FileReader.Workers.
+	Workers int
+
+	once sync.Once
+	dav  *webdav.Handler
+}
+
+// etag returns the value for the ETag header for f.
+func etag(f *File) string {
+	return `"` + f.Fingerprint() + `"`
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if h.WebDAV && (r.Method == http.MethodOptions || r.Method == "PROPFIND") {
+			h.once.Do(func() {
+				h.dav = &webdav.Handler{
+					FileSystem: davFS{t: h.Tree, workers: h.Workers},
+					LockSystem: webdav.NewMemLS(),
+				}
+			})
+
+			h.dav.ServeHTTP(w, r)
+			return
+		}
+
+		allow := "GET, HEAD"
+		if h.WebDAV {
+			allow += ", OPTIONS, PROPFIND"
+		}
+
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := path.Clean("/" + r.URL.Path)
+	d, entry, ok, err := h.Tree.lookup("open", p)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if ok && entry.Type == fuseutil.DT_Directory {
+		d = d.Subdir(entry)
+		ok = false
+	}
+
+	// directories
+	if !ok {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(p)+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		h.serveDir(w, r, d)
+		return
+	}
+
+	if entry.Type != fuseutil.DT_File {
+		http.Error(w, "not a regular file", http.StatusForbidden)
+		return
+	}
+
+	f := d.File(entry)
+	attr := d.EntryAttributes(entry)
+
+	w.Header().Set("ETag", etag(f))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	rd := NewFileReader(f)
+	rd.Workers = h.Workers
+	rd.Limit = rangeEnd(r)
+	http.ServeContent(w, r, entry.Name, attr.Mtime, rd)
+}
+
+// rangeEnd returns the end of the last range requested in the Range header of
+// r, or zero if the content up to the end of the file may be sent.
+func rangeEnd(r *http.Request) int64 {
+	s := r.Header.Get("Range")
+	if !strings.HasPrefix(s, "bytes=") {
+		return 0
+	}
+
+	var end int64
+	for _, spec := range strings.Split(s[len("bytes="):], ",") {
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return 0
+		}
+
+		// suffix ranges and ranges without an end reach the end of the file
+		last, err := strconv.ParseInt(strings.TrimSpace(spec[i+1:]), 10, 64)
+		if strings.TrimSpace(spec[:i]) == "" || err != nil || last < 0 {
+			return 0
+		}
+
+		if last+1 > end {
+			end = last + 1
+		}
+	}
+
+	return end
+}
+
+// serveDir writes a listing of d in HTML.
+func (h *HTTPHandler) serveDir(w http.ResponseWriter, r *http.Request, d *Dir) {
+	attr := d.Attributes()
+	w.Header().Set("Last-Modified", attr.Mtime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	names := make([]string, 0, len(d.entries))
+	for _, entry := range d.entries {
+		name := entry.Name
+		if entry.Type == fuseutil.DT_Directory {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, name := range names {
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// davFS is a read-only webdav.FileSystem for a tree.
+type davFS struct {
+	t       *Tree
+	workers int
+}
+
+func (fs davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs davFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (fs davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// davInfo is the information about an entry returned to the WebDAV handler.
+// It implements webdav.ETager.
+type davInfo struct {
+	FileInfo
+	d *Dir
+}
+
+// ETag returns the fingerprint of a file.
+func (fi davInfo) ETag(ctx context.Context) (string, error) {
+	if fi.entry.Type != fuseutil.DT_File || fi.d == nil {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return etag(fi.d.File(fi.entry)), nil
+}
+
+// ContentType returns the content type, so the content does not need to be
+// read to guess it.
+func (fi davInfo) ContentType(ctx context.Context) (string, error) {
+	return "application/octet-stream", nil
+}
+
+func (fs davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	d, entry, ok, err := fs.t.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		fi, err := fs.t.Stat("/")
+		return davInfo{FileInfo: fi}, err
+	}
+
+	return davInfo{FileInfo: FileInfo{name: entry.Name, attr: d.EntryAttributes(entry), entry: entry}, d: d}, nil
+}
+
+func (fs davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := fi.(davInfo)
+	file := &davFile{info: info, FileReader: NewFileReader(&File{})}
+
+	switch info.entry.Type {
+	case fuseutil.DT_Directory:
+		d, err := fs.t.OpenDir(name)
+		if err != nil {
+			return nil, err
+		}
+		file.dir = d
+	case fuseutil.DT_File:
+		file.FileReader = NewFileReader(info.d.File(info.entry))
+		file.FileReader.Workers = fs.workers
+	}
+
+	return file, nil
+}
+
+// davFile is a file or directory opened via WebDAV.
+type davFile struct {
+	*FileReader
+	info davInfo
+
+	// dir is set for directories, off is the number of entries returned by
+	// Readdir.
+	dir *Dir
+	off int
+}
+
+func (f *davFile) Close() error { return nil }
+
+func (f *davFile) Stat() (os.FileInfo, error) { return f.info, nil }
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// Readdir returns the next count entries of a directory, or all remaining
+// entries if count <= 0.
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.dir == nil {
+		return nil, os.ErrInvalid
+	}
+
+	rest := f.dir.entries[f.off:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+	f.off += len(rest)
+
+	list := make([]os.FileInfo, 0, len(rest))
+	for _, entry := range rest {
+		list = append(list, davInfo{
+			FileInfo: FileInfo{name: entry.Name, attr: f.dir.EntryAttributes(entry), entry: entry},
+			d:        f.dir,
+		})
+	}
+
+	return list, nil
+}
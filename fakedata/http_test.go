@@ -0,0 +1,146 @@
+package fakedata
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func httpRequest(t testing.TB, h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPHandler(t *testing.T) {
+	tree := newTestTree()
+	h := &HTTPHandler{Tree: tree}
+
+	var dir, file DirEntry
+	for _, entry := range tree.Root().Entries() {
+		switch entry.Type {
+		case fuseutil.DT_Directory:
+			dir = entry
+		case fuseutil.DT_File:
+			if entry.Size > 1000 {
+				file = entry
+			}
+		}
+	}
+
+	rec := httpRequest(t, h, "GET", "/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="`+dir.Name+`/"`) {
+		t.Fatalf("wrong listing: %v %s", rec.Code, rec.Body)
+	}
+
+	rec = httpRequest(t, h, "GET", "/"+dir.Name, nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/"+dir.Name+"/" {
+		t.Errorf("wrong redirect for directory: %v %v", rec.Code, rec.Header())
+	}
+
+	want, err := tree.Root().File(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httpRequest(t, h, "GET", "/"+file.Name, nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Fatalf("wrong content: %v", rec.Code)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Errorf("ETag or Last-Modified missing: %v", rec.Header())
+	}
+
+	// the ETag is deterministic
+	if other := httpRequest(t, &HTTPHandler{Tree: newTestTree()}, "HEAD", "/"+file.Name, nil); other.Header().Get("ETag") != etag {
+		t.Errorf("ETag differs for the same tree")
+	}
+
+	rec = httpRequest(t, h, "GET", "/"+file.Name, map[string]string{"Range": "bytes=500-999"})
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), want[500:1000]) {
+		t.Errorf("wrong response for range request: %v", rec.Code)
+	}
+
+	rec = httpRequest(t, h, "GET", "/"+file.Name, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("wrong response for conditional request: %v", rec.Code)
+	}
+
+	for _, target := range []string{"/does-not-exist", "/" + file.Name + "/foo", "/" + dir.Name + "/missing/foo"} {
+		if rec = httpRequest(t, h, "GET", target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %v returned %v", target, rec.Code)
+		}
+	}
+
+	if rec = httpRequest(t, h, "PROPFIND", "/", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PROPFIND without WebDAV returned %v", rec.Code)
+	}
+}
+
+func TestHTTPHandlerWebDAV(t *testing.T) {
+	tree := newTestTree()
+	h := &HTTPHandler{Tree: tree, WebDAV: true}
+
+	rec := httpRequest(t, h, "PROPFIND", "/", map[string]string{"Depth": "1"})
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND returned %v: %s", rec.Code, rec.Body)
+	}
+
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range tree.Root().Entries() {
+		if !bytes.Contains(body, []byte("<D:href>/"+entry.Name)) {
+			t.Errorf("%v not listed", entry.Name)
+		}
+
+		if entry.Type == fuseutil.DT_File {
+			etag := etag(tree.Root().File(entry))
+			if !bytes.Contains(body, []byte("<D:getetag>"+etag+"</D:getetag>")) {
+				t.Errorf("ETag for %v not found", entry.Name)
+			}
+		}
+	}
+
+	for _, method := range []string{"PUT", "DELETE", "MKCOL"} {
+		if rec = httpRequest(t, h, method, "/foo", nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%v returned %v", method, rec.Code)
+		}
+	}
+}
+
+func TestRangeEnd(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		end    int64
+	}{
+		{"", 0},
+		{"bytes=500-999", 1000},
+		{"bytes=0-0, 10-19", 20},
+		{"bytes=100-", 0},
+		{"bytes=-100", 0},
+		{"bytes=0-9,-5", 0},
+		{"items=0-9", 0},
+		{"bytes=foo", 0},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Range", test.header)
+		if end := rangeEnd(req); end != test.end {
+			t.Errorf("range %q: want end %d, got %d", test.header, test.end, end)
+		}
+	}
+}
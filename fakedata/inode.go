@@ -0,0 +1,49 @@
+package fakedata
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// MaxInode is the largest inode of a generated entry. Inodes above it are
+// free for entries created outside of the generator, e.g. in an overlay.
+const MaxInode = 1<<63 - 1
+
+// inode returns the deterministic inode for the path p in the selected
+// format.
+func (cfg *Config) inode(p string) fuseops.InodeID {
+	if cfg.format() < FormatV3 {
+		return inodePathV1(p)
+	}
+
+	return inodePath(p)
+}
+
+// inodePath returns a deterministic 63 bit inode for the path p. With 63
+// bits, inodes of different paths practically never collide, even for trees
+// with hundreds of millions of entries. The inodes of the root directory
+// and zero are never returned.
+func inodePath(p string) fuseops.InodeID {
+	hash := sha1.Sum([]byte(p))
+	inode := binary.LittleEndian.Uint64(hash[:]) & MaxInode
+	if inode <= fuseops.RootInodeID {
+		inode += fuseops.RootInodeID + 1
+	}
+
+	return fuseops.InodeID(inode)
+}
+
+// inodePathV1 returns the deterministic 32 bit inode for the path p used by
+// FormatV1 and FormatV2. Inodes of different paths collide in large trees.
+func inodePathV1(p string) fuseops.InodeID {
+	var inode uint64
+	hash := sha1.Sum([]byte(p))
+	for i := 0; i < 4; i++ {
+		shift := uint(i) * 8
+		inode |= uint64(hash[i]) << shift
+	}
+
+	return fuseops.InodeID(inode)
+}
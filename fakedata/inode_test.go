@@ -0,0 +1,70 @@
+package fakedata
+
+import (
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+var inodePathTests = []struct {
+	path    string
+	inode   fuseops.InodeID
+	inodeV1 fuseops.InodeID
+}{
+	{"/", 4604123509983742274, 1251674434},
+	{"/foo/bar", 7353682188653440168, 902704296},
+}
+
+func TestInodePath(t *testing.T) {
+	for i, test := range inodePathTests {
+		inode := inodePath(test.path)
+
+		if inode != test.inode {
+			t.Errorf("test %d: wrong inode returned, want %d, got %d", i, test.inode, inode)
+		}
+
+		inode = inodePathV1(test.path)
+		if inode != test.inodeV1 {
+			t.Errorf("test %d: wrong V1 inode returned, want %d, got %d", i, test.inodeV1, inode)
+		}
+
+		for _, format := range []int{FormatV1, FormatV2, FormatV3} {
+			cfg := Config{FormatVersion: format}
+			want := test.inodeV1
+			if format >= FormatV3 {
+				want = test.inode
+			}
+
+			if inode = cfg.inode(test.path); inode != want {
+				t.Errorf("test %d: wrong inode returned for format %d, want %d, got %d", i, format, want, inode)
+			}
+		}
+	}
+}
+
+func TestTreeInodesUnique(t *testing.T) {
+	cfg := Config{
+		Seed:        23,
+		MaxSize:     1 << 10,
+		FilesPerDir: 100,
+		DirsPerDir:  10,
+		Depth:       3,
+	}
+
+	inodes := make(map[fuseops.InodeID]string)
+	err := NewTree(cfg).Walk(func(p string, fi FileInfo) error {
+		inode := fi.Inode()
+		if inode > MaxInode {
+			t.Errorf("%v: inode %d out of range", p, inode)
+		}
+
+		if other, ok := inodes[inode]; ok {
+			t.Errorf("%v: inode %d is also used by %v", p, inode, other)
+		}
+		inodes[inode] = p
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,240 @@
+//go:build go1.16
+// +build go1.16
+
+package fakedata
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// FS returns the tree as an fs.FS, which also implements fs.ReadDirFS,
+// fs.ReadFileFS and fs.StatFS. Files opened from it implement io.ReaderAt and
+// io.Seeker. Symlinks and special files are returned as empty files, they
+// are not followed.
+func (t *Tree) FS() fs.FS {
+	return treeFS{t}
+}
+
+type treeFS struct {
+	t *Tree
+}
+
+// treePath returns the path within the tree for the fs.FS name.
+func treePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	return path.Join("/", name), nil
+}
+
+// pathError converts errors returned by the tree to the errors expected for
+// an fs.FS.
+func pathError(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: op, Path: name, Err: pe.Err}
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open opens the entry name.
+func (f treeFS) Open(name string) (fs.File, error) {
+	p, err := treePath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.t.Stat(p)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	if p == "/" {
+		fi.name = "."
+	}
+
+	switch fi.entry.Type {
+	case fuseutil.DT_Directory:
+		d, err := f.t.OpenDir(p)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+
+		return &fsDir{fi: fi, entries: dirEntries(d)}, nil
+	case fuseutil.DT_File:
+		rd, err := f.t.Open(p)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+
+		return &fsFile{FileReader: rd, fi: fi}, nil
+	default:
+		return &fsFile{FileReader: NewFileReader(&File{}), fi: fi}, nil
+	}
+}
+
+// Stat returns information about the entry name.
+func (f treeFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := treePath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.t.Stat(p)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+
+	if p == "/" {
+		fi.name = "."
+	}
+
+	return fi, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (f treeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := treePath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := f.t.OpenDir(p)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	list := dirEntries(d)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+
+	return list, nil
+}
+
+// ReadFile returns the content of the file name.
+func (f treeFS) ReadFile(name string) ([]byte, error) {
+	p, err := treePath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.t.Stat(p)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+
+	switch fi.entry.Type {
+	case fuseutil.DT_Directory:
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	case fuseutil.DT_File:
+		rd, err := f.t.Open(p)
+		if err != nil {
+			return nil, pathError("readfile", name, err)
+		}
+
+		return rd.File().ReadAll()
+	default:
+		return []byte{}, nil
+	}
+}
+
+// fsDirEntry is an entry returned by ReadDir. The information about the entry
+// is only generated when Info is called.
+type fsDirEntry struct {
+	d     *Dir
+	entry DirEntry
+}
+
+func (e fsDirEntry) Name() string { return e.entry.Name }
+
+func (e fsDirEntry) IsDir() bool { return e.entry.Type == fuseutil.DT_Directory }
+
+func (e fsDirEntry) Type() fs.FileMode {
+	if e.entry.Type == fuseutil.DT_Directory {
+		return fs.ModeDir
+	}
+
+	if e.entry.Type == fuseutil.DT_Link {
+		return fs.ModeSymlink
+	}
+
+	return specialMode(e.entry.Type)
+}
+
+func (e fsDirEntry) Info() (fs.FileInfo, error) {
+	return FileInfo{name: e.entry.Name, attr: e.d.EntryAttributes(e.entry), entry: e.entry}, nil
+}
+
+// dirEntries returns the entries of d in the order they were generated.
+func dirEntries(d *Dir) []fs.DirEntry {
+	list := make([]fs.DirEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		list = append(list, fsDirEntry{d: d, entry: entry})
+	}
+
+	return list
+}
+
+// fsFile is a file opened from the fs.FS.
+type fsFile struct {
+	*FileReader
+	fi FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+
+func (f *fsFile) Close() error { return nil }
+
+// fsDir is a directory opened from the fs.FS.
+type fsDir struct {
+	fi      FileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.fi.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining entries if n <= 0.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.off += n
+	return rest[:n], nil
+}
+
+// ensure the interfaces are implemented
+var (
+	_ fs.ReadDirFS   = treeFS{}
+	_ fs.ReadFileFS  = treeFS{}
+	_ fs.StatFS      = treeFS{}
+	_ fs.ReadDirFile = &fsDir{}
+	_ io.ReaderAt    = &fsFile{}
+	_ io.Seeker      = &fsFile{}
+)
@@ -0,0 +1,91 @@
+//go:build go1.16
+// +build go1.16
+
+package fakedata
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func TestFS(t *testing.T) {
+	// fstest reads files byte by byte, so keep them small
+	tree := NewTree(Config{
+		Seed: 23, MaxSize: 4096, FilesPerDir: 4, DirsPerDir: 2, Depth: 2,
+		SymlinksPerDir: 1, HardlinksPerDir: 1, SpecialPerDir: 1, SparseRate: 0.5,
+	})
+	fsys := tree.FS()
+
+	var expected []string
+	for _, entry := range tree.Root().Entries() {
+		expected = append(expected, entry.Name)
+	}
+
+	err := fstest.TestFS(fsys, expected...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSContent(t *testing.T) {
+	tree := newTestTree()
+	fsys := tree.FS()
+
+	err := tree.Root().Walk(func(d *Dir, entry DirEntry) error {
+		if entry.Type != fuseutil.DT_File {
+			return nil
+		}
+
+		want, err := d.File(entry).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := path.Join(d.Path(), entry.Name)[1:]
+		buf, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, want) {
+			t.Errorf("%v: wrong content", name)
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// files support random access
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			t.Fatalf("%v does not implement io.ReaderAt", name)
+		}
+
+		if len(want) > 100 {
+			p := make([]byte, 50)
+			_, err = ra.ReadAt(p, int64(len(want)/2))
+			if err != nil || !bytes.Equal(p, want[len(want)/2:len(want)/2+50]) {
+				t.Errorf("%v: ReadAt returned wrong data: %v", name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/", "does-not-exist", "../foo"} {
+		if _, err = fsys.Open(name); err == nil {
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+}
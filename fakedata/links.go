@@ -0,0 +1,153 @@
+package fakedata
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// SymlinkKind describes where a symlink points to.
+type SymlinkKind int
+
+// These are the kinds of symlinks which are generated.
+const (
+	// SymlinkRelative points to another file in the same directory.
+	SymlinkRelative SymlinkKind = iota
+	// SymlinkAbsolute points to another file using the absolute path within
+	// the file system.
+	SymlinkAbsolute
+	// SymlinkDangling points to a file which does not exist.
+	SymlinkDangling
+	// SymlinkLoop points to itself.
+	SymlinkLoop
+
+	numSymlinkKinds
+)
+
+// specialTypes are the types of special files which are generated.
+var specialTypes = []struct {
+	name string
+	typ  fuseutil.DirentType
+	mode os.FileMode
+}{
+	{"fifo", fuseutil.DT_FIFO, os.ModeNamedPipe},
+	{"chardev", fuseutil.DT_Char, os.ModeDevice | os.ModeCharDevice},
+	{"blockdev", fuseutil.DT_Block, os.ModeDevice},
+	{"socket", fuseutil.DT_Socket, os.ModeSocket},
+}
+
+// specialMode returns the file mode for a special file of type typ.
+func specialMode(typ fuseutil.DirentType) os.FileMode {
+	for _, t := range specialTypes {
+		if t.typ == typ {
+			return t.mode
+		}
+	}
+
+	return 0
+}
+
+// DirentType returns the type of a directory entry with mode.
+func DirentType(mode os.FileMode) fuseutil.DirentType {
+	switch {
+	case mode.IsDir():
+		return fuseutil.DT_Directory
+	case mode&os.ModeSymlink != 0:
+		return fuseutil.DT_Link
+	case mode&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice) != 0:
+		for _, t := range specialTypes {
+			if mode&os.ModeType == t.mode {
+				return t.typ
+			}
+		}
+	}
+
+	return fuseutil.DT_File
+}
+
+// addLinks adds symlinks, hardlinks and special files to the directory. It
+// uses a separate source of randomness so that the names of the other
+// entries do not depend on whether links are generated.
+func (d *Dir) addLinks() {
+	if d.cfg.SymlinksPerDir <= 0 && d.cfg.HardlinksPerDir <= 0 && d.cfg.SpecialPerDir <= 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(d.seed, "links")))
+
+	var files []int
+	for i, entry := range d.entries {
+		if entry.Type == fuseutil.DT_File {
+			files = append(files, i)
+		}
+	}
+
+	for i := 0; i < d.cfg.SymlinksPerDir; i++ {
+		name := fmt.Sprintf("link-%d", rnd.Int())
+		kind := SymlinkKind(i % int(numSymlinkKinds))
+		if len(files) == 0 && (kind == SymlinkRelative || kind == SymlinkAbsolute) {
+			kind = SymlinkDangling
+		}
+
+		var target string
+		switch kind {
+		case SymlinkRelative:
+			target = d.entries[files[rnd.Intn(len(files))]].Name
+		case SymlinkAbsolute:
+			target = path.Join(d.path, d.entries[files[rnd.Intn(len(files))]].Name)
+		case SymlinkDangling:
+			target = fmt.Sprintf("missing-%d", rnd.Int())
+		case SymlinkLoop:
+			target = name
+		}
+
+		p := path.Join(d.path, name)
+		d.entries = append(d.entries, DirEntry{
+			Dirent: fuseutil.Dirent{
+				Name:  name,
+				Type:  fuseutil.DT_Link,
+				Inode: d.cfg.inode(p),
+			},
+			Seed:   d.cfg.seedForPath(d.seed, "link", p),
+			Target: target,
+		})
+	}
+
+	// hardlinks share the inode with the file, all names of the file need
+	// the same link count
+	nlink := make(map[fuseops.InodeID]uint32)
+	for i := 0; i < d.cfg.HardlinksPerDir && len(files) > 0; i++ {
+		link := d.entries[files[rnd.Intn(len(files))]]
+		if nlink[link.Inode] == 0 {
+			nlink[link.Inode] = 1
+		}
+		nlink[link.Inode]++
+
+		link.Name = fmt.Sprintf("hardlink-%d", rnd.Int())
+		d.entries = append(d.entries, link)
+	}
+
+	for i := range d.entries {
+		if n, ok := nlink[d.entries[i].Inode]; ok && d.entries[i].Type == fuseutil.DT_File {
+			d.entries[i].Nlink = n
+		}
+	}
+
+	for i := 0; i < d.cfg.SpecialPerDir; i++ {
+		t := specialTypes[i%len(specialTypes)]
+		name := fmt.Sprintf("%s-%d", t.name, rnd.Int())
+		p := path.Join(d.path, name)
+		d.entries = append(d.entries, DirEntry{
+			Dirent: fuseutil.Dirent{
+				Name:  name,
+				Type:  t.typ,
+				Inode: d.cfg.inode(p),
+			},
+			Seed: d.cfg.seedForPath(d.seed, t.name, p),
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package fakedata
+
+import "testing"
+
+func TestLinksDoNotChangeNames(t *testing.T) {
+	cfg := Config{Seed: 23, MaxSize: 1024, FilesPerDir: 10}
+	d1 := NewDir(&cfg, 23, "/", 0)
+
+	cfg.SymlinksPerDir = 5
+	cfg.HardlinksPerDir = 5
+	cfg.SpecialPerDir = 5
+	d2 := NewDir(&cfg, 23, "/", 0)
+
+	for i, entry := range d1.entries {
+		if d2.entries[i].Name != entry.Name {
+			t.Errorf("entry %d: name changed from %v to %v", i, entry.Name, d2.entries[i].Name)
+		}
+	}
+}
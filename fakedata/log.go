@@ -0,0 +1,11 @@
+package fakedata
+
+// Logf is called with debug messages about the generated entries, if set.
+var Logf func(format string, args ...interface{})
+
+// debugf passes a debug message to Logf.
+func debugf(format string, args ...interface{}) {
+	if Logf != nil {
+		Logf(format, args...)
+	}
+}
@@ -0,0 +1,255 @@
+package fakedata
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// ManifestEntry describes an entry of the tree.
+type ManifestEntry struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Inode uint64 `json:"inode"`
+	Size  uint64 `json:"size"`
+
+	// Mode is the mode in octal as returned by stat(2), e.g. 100644 or
+	// 040755.
+	Mode  string    `json:"mode"`
+	Mtime time.Time `json:"mtime"`
+
+	Target string `json:"target,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// manifestFields are the columns of a manifest in CSV format.
+var manifestFields = []string{"path", "type", "inode", "size", "mode", "mtime", "target", "sha256"}
+
+// typeName returns the name of the type as used in tree specifications.
+func typeName(typ fuseutil.DirentType) string {
+	switch typ {
+	case fuseutil.DT_File:
+		return "file"
+	case fuseutil.DT_Directory:
+		return "dir"
+	case fuseutil.DT_Link:
+		return "symlink"
+	}
+
+	for _, t := range specialTypes {
+		if t.typ == typ {
+			return t.name
+		}
+	}
+
+	return "unknown"
+}
+
+// Manifest collects the entries of a tree. It is a TreeWriter, the
+// checksums of the files are computed while the tree is written and are
+// complete when it is closed.
+type Manifest struct {
+	// Checksums enables computing the SHA-256 hashes of the files, Workers
+	// is the number of files hashed in parallel.
+	Checksums bool
+	Workers   int
+
+	Entries []ManifestEntry
+
+	// m protects Entries and err while files are hashed.
+	m   sync.Mutex
+	err error
+
+	// jobs is the queue of files to hash, it is created on the first call
+	// to Write. It is bounded, so Write blocks while all workers are busy.
+	jobs chan manifestJob
+	wg   sync.WaitGroup
+
+	// links maps the inodes of files with hardlinks to the entry which is
+	// hashed, hardlinks maps the other entries for these files to it.
+	links     map[fuseops.InodeID]int
+	hardlinks map[int]int
+}
+
+// manifestJob is a file to be hashed for the entry at index i.
+type manifestJob struct {
+	i    int
+	file *File
+}
+
+// start starts the workers which hash the files.
+func (m *Manifest) start() {
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	m.jobs = make(chan manifestJob, workers)
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			for j := range m.jobs {
+				m.hash(j)
+			}
+		}()
+	}
+}
+
+// hash computes the checksum for a job.
+func (m *Manifest) hash(j manifestJob) {
+	m.m.Lock()
+	failed := m.err != nil
+	m.m.Unlock()
+	if failed {
+		return
+	}
+
+	hash := sha256.New()
+	_, err := io.CopyN(hash, ContinuousFileReader(j.file, 0), int64(j.file.Size))
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if err != nil {
+		if m.err == nil {
+			m.err = fmt.Errorf("%v: %v", m.Entries[j.i].Path, err)
+		}
+		return
+	}
+
+	m.Entries[j.i].SHA256 = hex.EncodeToString(hash.Sum(nil))
+}
+
+// Write adds the entry item to the manifest.
+func (m *Manifest) Write(item treeItem) error {
+	entry := ManifestEntry{
+		Path:   "/" + item.Path,
+		Type:   typeName(item.Type),
+		Inode:  uint64(item.Inode),
+		Size:   item.Attr.Size,
+		Mode:   fmt.Sprintf("%06o", unixMode(item.Attr.Mode)),
+		Mtime:  item.Attr.Mtime.UTC(),
+		Target: item.Target,
+	}
+
+	m.m.Lock()
+	err := m.err
+	i := len(m.Entries)
+	m.Entries = append(m.Entries, entry)
+	m.m.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if item.Type != fuseutil.DT_File || !m.Checksums {
+		return nil
+	}
+
+	// files with hardlinks are only hashed once
+	if item.Attr.Nlink > 1 {
+		if m.links == nil {
+			m.links = make(map[fuseops.InodeID]int)
+			m.hardlinks = make(map[int]int)
+		}
+
+		if first, ok := m.links[item.Inode]; ok {
+			m.hardlinks[i] = first
+			return nil
+		}
+		m.links[item.Inode] = i
+	}
+
+	if m.jobs == nil {
+		m.start()
+	}
+
+	m.jobs <- manifestJob{i: i, file: item.File}
+	return nil
+}
+
+// Close waits until the checksums of all files have been computed.
+func (m *Manifest) Close() error {
+	if m.jobs != nil {
+		close(m.jobs)
+		m.wg.Wait()
+		m.jobs = nil
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+
+	for i, first := range m.hardlinks {
+		m.Entries[i].SHA256 = m.Entries[first].SHA256
+	}
+
+	m.links, m.hardlinks = nil, nil
+	return nil
+}
+
+// WriteJSON writes the manifest as a JSON array to wr.
+func (m *Manifest) WriteJSON(wr io.Writer) error {
+	_, err := io.WriteString(wr, "[\n")
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range m.Entries {
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		sep := ",\n"
+		if i == len(m.Entries)-1 {
+			sep = "\n"
+		}
+
+		_, err = fmt.Fprintf(wr, "  %s%s", buf, sep)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(wr, "]\n")
+	return err
+}
+
+// WriteCSV writes the manifest in CSV format with a header line to wr.
+func (m *Manifest) WriteCSV(wr io.Writer) error {
+	w := csv.NewWriter(wr)
+	err := w.Write(manifestFields)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range m.Entries {
+		err = w.Write([]string{
+			entry.Path,
+			entry.Type,
+			strconv.FormatUint(entry.Inode, 10),
+			strconv.FormatUint(entry.Size, 10),
+			entry.Mode,
+			entry.Mtime.Format(time.RFC3339Nano),
+			entry.Target,
+			entry.SHA256,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,122 @@
+package fakedata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func newTestManifest(t testing.TB, workers int) *Manifest {
+	m := &Manifest{Checksums: true, Workers: workers}
+	err := WriteTree(newGenerateTestDir(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestManifest(t *testing.T) {
+	m := newTestManifest(t, 1)
+	files := walkFiles(t, newGenerateTestDir())
+
+	n := 0
+	for _, entry := range m.Entries {
+		if entry.Type != "file" {
+			if entry.SHA256 != "" {
+				t.Errorf("%v: checksum for type %v", entry.Path, entry.Type)
+			}
+			continue
+		}
+
+		sum := sha256.Sum256(files[entry.Path[1:]])
+		if entry.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%v: wrong checksum %v", entry.Path, entry.SHA256)
+		}
+		n++
+	}
+
+	if n != len(files) {
+		t.Errorf("manifest contains %d files, want %d", n, len(files))
+	}
+
+	// the result does not depend on the number of workers
+	if m2 := newTestManifest(t, 4); !reflect.DeepEqual(m.Entries, m2.Entries) {
+		t.Errorf("manifest computed in parallel differs")
+	}
+}
+
+func TestManifestSameInode(t *testing.T) {
+	m := &Manifest{Checksums: true, Workers: 2}
+
+	// files with the same inode only share the checksum if they are hardlinks
+	for i, name := range []string{"a", "b"} {
+		item := treeItem{Path: name, Type: fuseutil.DT_File, Inode: 23, File: NewFile(int64(i), 100, 23)}
+		item.Attr.Nlink = 1
+		err := m.Write(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Entries[0].SHA256 == m.Entries[1].SHA256 {
+		t.Errorf("files which are not hardlinks have the same checksum %v", m.Entries[0].SHA256)
+	}
+}
+
+func TestManifestFormats(t *testing.T) {
+	m := newTestManifest(t, 2)
+
+	buf := bytes.NewBuffer(nil)
+	err := m.WriteJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []ManifestEntry
+	err = json.Unmarshal(buf.Bytes(), &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(entries, m.Entries) {
+		t.Errorf("entries differ after decoding JSON")
+	}
+
+	buf.Reset()
+	err = m.WriteCSV(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(m.Entries)+1 {
+		t.Fatalf("wrong number of records %d, want %d", len(records), len(m.Entries)+1)
+	}
+
+	if !reflect.DeepEqual(records[0], manifestFields) {
+		t.Errorf("wrong header %v", records[0])
+	}
+
+	for i, rec := range records[1:] {
+		entry := m.Entries[i]
+		if rec[0] != entry.Path || rec[4] != entry.Mode || rec[7] != entry.SHA256 {
+			t.Errorf("wrong record %v for %v", rec, entry)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package fakedata
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// baseTime is the modification time of all items which have not been
+// changed since the initial generation, unless a range for the modification
+// times is configured.
+var baseTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// generationInterval is the time between two generations.
+const generationInterval = 24 * time.Hour
+
+// atimeSpread is the maximal time between the modification and the last
+// access of a file.
+const atimeSpread = 30 * 24 * time.Hour
+
+// specialBits are the bits set for files selected by SpecialBitsRate.
+var specialBits = []os.FileMode{os.ModeSetuid, os.ModeSetgid, os.ModeSticky}
+
+// PermBits are the bits of a mode which can be changed with chmod.
+const PermBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// timeRange returns the range for the modification times of the initial
+// generation.
+func (cfg *Config) timeRange() (min, max time.Time) {
+	min, max = cfg.MtimeMin, cfg.MtimeMax
+	if min.IsZero() {
+		min = baseTime
+	}
+	if max.Before(min) {
+		max = min
+	}
+	return min, max
+}
+
+// generationTime returns the time at which generation gen starts. All items
+// changed in this generation have a modification time within
+// generationInterval after it.
+func (cfg *Config) generationTime(gen int) time.Time {
+	_, max := cfg.timeRange()
+	return max.Add(time.Duration(gen) * generationInterval)
+}
+
+// attributes returns the attributes derived from seed for an item which was
+// created in generation created and last modified in generation modified.
+// Mode is set to perm if it is not zero, otherwise one of the configured
+// modes is selected.
+func (cfg *Config) attributes(seed int64, created, modified int, perm os.FileMode) fuseops.InodeAttributes {
+	rnd := rand.New(rand.NewSource(deriveSeed(seed, "metadata")))
+
+	// always use the same number of random values, so that the attributes
+	// do not depend on each other
+	var (
+		initial = rnd.Float64()
+		jitterC = time.Duration(rnd.Int63n(int64(generationInterval)))
+		jitterM = time.Duration(rnd.Int63n(int64(generationInterval)))
+		atime   = time.Duration(rnd.Int63n(int64(atimeSpread)))
+		uid     = rnd.Int()
+		gid     = rnd.Int()
+		mode    = rnd.Int()
+		special = rnd.Float64()
+		bit     = rnd.Intn(len(specialBits))
+		noread  = rnd.Float64()
+	)
+
+	min, max := cfg.timeRange()
+	crtime := min.Add(time.Duration(initial * float64(max.Sub(min))))
+	if created > 0 {
+		crtime = cfg.generationTime(created).Add(jitterC)
+	}
+
+	mtime := crtime
+	if modified > created {
+		mtime = cfg.generationTime(modified).Add(jitterM)
+	}
+
+	attr := fuseops.InodeAttributes{
+		Nlink: 1,
+
+		Atime:  mtime.Add(atime),
+		Mtime:  mtime,
+		Ctime:  mtime,
+		Crtime: crtime,
+
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if len(cfg.Uids) > 0 {
+		attr.Uid = cfg.Uids.pick(uid)
+	}
+
+	if len(cfg.Gids) > 0 {
+		attr.Gid = cfg.Gids.pick(gid)
+	}
+
+	if perm != 0 {
+		attr.Mode = perm
+		return attr
+	}
+
+	attr.Mode = 0644
+	if len(cfg.Modes) > 0 {
+		attr.Mode = cfg.Modes[mode%len(cfg.Modes)]
+	}
+
+	if special < cfg.SpecialBitsRate {
+		attr.Mode |= specialBits[bit]
+	}
+
+	if noread < cfg.UnreadableRate {
+		attr.Mode &^= 0444
+	}
+
+	return attr
+}
+
+// dirAttributes returns the attributes for the directory with seed which was
+// last modified in generation modified.
+func (cfg *Config) dirAttributes(seed int64, modified int) fuseops.InodeAttributes {
+	attr := cfg.attributes(seed, 0, modified, 0555)
+	attr.Mode |= os.ModeDir
+	return attr
+}
+
+// fileAttributes returns the attributes for the file described by entry.
+//
+// The fuse library computes the number of allocated blocks from the size and
+// does not pass lseek requests to the file system, so sparse files look fully
+// allocated when accessed through the mount. See File.Blocks and
+// FileReader.Seek for the model.
+func (cfg *Config) fileAttributes(entry DirEntry) fuseops.InodeAttributes {
+	attr := cfg.attributes(entry.Seed, entry.Created, entry.Modified, 0)
+	attr.Size = uint64(entry.Size)
+	if entry.Nlink > 0 {
+		attr.Nlink = entry.Nlink
+	}
+	entry.fixed.apply(&attr)
+	return attr
+}
+
+// symlinkAttributes returns the attributes for the symlink entry.
+func (cfg *Config) symlinkAttributes(entry DirEntry) fuseops.InodeAttributes {
+	attr := cfg.attributes(entry.Seed, 0, 0, 0777)
+	attr.Mode |= os.ModeSymlink
+	attr.Size = uint64(len(entry.Target))
+	entry.fixed.apply(&attr)
+	return attr
+}
+
+// specialAttributes returns the attributes for the special file entry.
+func (cfg *Config) specialAttributes(entry DirEntry) fuseops.InodeAttributes {
+	attr := cfg.attributes(entry.Seed, 0, 0, 0)
+	attr.Mode |= specialMode(entry.Type)
+	entry.fixed.apply(&attr)
+	return attr
+}
+
+// entryAttributes returns the attributes for entry, which must not be a
+// directory.
+func (cfg *Config) entryAttributes(entry DirEntry) fuseops.InodeAttributes {
+	switch entry.Type {
+	case fuseutil.DT_File:
+		return cfg.fileAttributes(entry)
+	case fuseutil.DT_Link:
+		return cfg.symlinkAttributes(entry)
+	}
+
+	return cfg.specialAttributes(entry)
+}
+
+// parseTime parses a date or a date with time in RFC 3339 format.
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// ParseTimeRange parses a range of times in the form "start..end", both
+// start and end are dates (2006-01-02) or times in RFC 3339 format.
+func ParseTimeRange(s string) (min, max time.Time, err error) {
+	parts := strings.SplitN(s, "..", 2)
+	if len(parts) != 2 {
+		return min, max, fmt.Errorf("invalid time range %q, want start..end", s)
+	}
+
+	min, err = parseTime(parts[0])
+	if err != nil {
+		return min, max, err
+	}
+
+	max, err = parseTime(parts[1])
+	if err != nil {
+		return min, max, err
+	}
+
+	if max.Before(min) {
+		return min, max, fmt.Errorf("invalid time range %q, end is before start", s)
+	}
+
+	return min, max, nil
+}
+
+// IDRange is a range of user or group IDs, including First and Last.
+type IDRange struct {
+	First, Last uint32
+}
+
+// IDs is a list of ranges of user or group IDs.
+type IDs []IDRange
+
+// pick returns the ID with index i mod the number of IDs in the list, all IDs
+// are selected with the same probability. It panics for an empty list.
+func (ids IDs) pick(i int) uint32 {
+	var n uint64
+	for _, r := range ids {
+		n += uint64(r.Last-r.First) + 1
+	}
+
+	idx := uint64(i) % n
+	for _, r := range ids {
+		size := uint64(r.Last-r.First) + 1
+		if idx < size {
+			return r.First + uint32(idx)
+		}
+		idx -= size
+	}
+
+	panic("index out of range")
+}
+
+// ParseIDs parses a comma separated list of user or group IDs. Each element
+// is either a single ID or a range of IDs like 1000-1005.
+func ParseIDs(s string) (ids IDs, err error) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+
+		start, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", part)
+		}
+
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid ID range %q", part)
+			}
+		}
+
+		ids = append(ids, IDRange{First: uint32(start), Last: uint32(end)})
+	}
+
+	return ids, nil
+}
+
+// ParseModes parses a comma separated list of octal permissions.
+func ParseModes(s string) (modes []os.FileMode, err error) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		mode, err := strconv.ParseUint(part, 8, 32)
+		if err != nil || mode&^0777 != 0 {
+			return nil, fmt.Errorf("invalid mode %q", part)
+		}
+
+		modes = append(modes, os.FileMode(mode))
+	}
+
+	return modes, nil
+}
@@ -0,0 +1,151 @@
+package fakedata
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileMetadata(t *testing.T) {
+	min := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cfg := Config{
+		Seed: 23, MaxSize: 1024, FilesPerDir: 200,
+		MtimeMin: min, MtimeMax: max,
+		Uids: IDs{{1000, 1001}}, Gids: IDs{{100, 100}},
+		Modes:           []os.FileMode{0644, 0755},
+		SpecialBitsRate: 0.2,
+		UnreadableRate:  0.1,
+	}
+	d := NewDir(&cfg, 23, "/", 0)
+
+	uids := make(map[uint32]int)
+	modes := make(map[os.FileMode]int)
+	mtimes := make(map[time.Time]struct{})
+	special, unreadable := 0, 0
+
+	for _, entry := range d.entries {
+		attr := cfg.fileAttributes(entry)
+		if !reflect.DeepEqual(attr, cfg.fileAttributes(entry)) {
+			t.Fatalf("%v: attributes are not deterministic", entry.Name)
+		}
+
+		if attr.Mtime.Before(min) || attr.Mtime.After(max) {
+			t.Errorf("%v: mtime %v out of range", entry.Name, attr.Mtime)
+		}
+
+		if attr.Atime.Before(attr.Mtime) || attr.Crtime.After(attr.Mtime) {
+			t.Errorf("%v: inconsistent times %v, %v, %v", entry.Name, attr.Crtime, attr.Mtime, attr.Atime)
+		}
+
+		if attr.Gid != 100 {
+			t.Errorf("%v: wrong gid %d", entry.Name, attr.Gid)
+		}
+
+		uids[attr.Uid]++
+		mtimes[attr.Mtime] = struct{}{}
+		modes[attr.Mode&0111]++
+
+		if attr.Mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != 0 {
+			special++
+		}
+
+		if attr.Mode&0444 == 0 {
+			unreadable++
+		}
+	}
+
+	if len(uids) != 2 || uids[1000] == 0 || uids[1001] == 0 {
+		t.Errorf("uids not distributed as expected: %v", uids)
+	}
+
+	if len(modes) != 2 {
+		t.Errorf("modes not distributed as expected: %v", modes)
+	}
+
+	if len(mtimes) < 150 {
+		t.Errorf("too few distinct mtimes: %d", len(mtimes))
+	}
+
+	if special < 20 || special > 60 {
+		t.Errorf("unexpected number of files with special bits: %d", special)
+	}
+
+	if unreadable < 5 || unreadable > 40 {
+		t.Errorf("unexpected number of unreadable files: %d", unreadable)
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	min, max, err := ParseTimeRange("2010-01-01..2020-06-01T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !min.Equal(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)) || !max.Equal(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong range %v..%v", min, max)
+	}
+
+	for _, s := range []string{"2010-01-01", "2020-01-01..2010-01-01", "foo..bar"} {
+		_, _, err = ParseTimeRange(s)
+		if err == nil {
+			t.Errorf("expected error for %q not found", s)
+		}
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	ids, err := ParseIDs("0, 1000-1002,5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, IDs{{0, 0}, {1000, 1002}, {5, 5}}) {
+		t.Errorf("wrong ids %v", ids)
+	}
+
+	// the IDs are selected as from a list of all IDs
+	want := []uint32{0, 1000, 1001, 1002, 5}
+	for i := 0; i < 2*len(want); i++ {
+		if id := ids.pick(i); id != want[i%len(want)] {
+			t.Errorf("pick(%d) returned %d, want %d", i, id, want[i%len(want)])
+		}
+	}
+
+	// large ranges are not expanded
+	ids, err = ParseIDs("0-4294967295")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := ids.pick(1<<31 - 1); id != 1<<31-1 {
+		t.Errorf("pick returned %d, want %d", id, 1<<31-1)
+	}
+
+	for _, s := range []string{"", "a", "5-3", "1-b"} {
+		_, err = ParseIDs(s)
+		if err == nil {
+			t.Errorf("expected error for %q not found", s)
+		}
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	modes, err := ParseModes("644,0600,000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(modes, []os.FileMode{0644, 0600, 0}) {
+		t.Errorf("wrong modes %v", modes)
+	}
+
+	for _, s := range []string{"", "999", "10000"} {
+		_, err = ParseModes(s)
+		if err == nil {
+			t.Errorf("expected error for %q not found", s)
+		}
+	}
+}
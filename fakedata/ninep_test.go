@@ -0,0 +1,414 @@
+package fakedata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// p9Client sends requests to a NinePServer.
+type p9Client struct {
+	t    testing.TB
+	conn net.Conn
+}
+
+func newP9Client(t testing.TB, tree *Tree) *p9Client {
+	client, server := net.Pipe()
+	go func() {
+		_ = (&NinePServer{Tree: tree}).ServeConn(server)
+		_ = server.Close()
+	}()
+
+	c := &p9Client{t: t, conn: client}
+
+	e := &p9Encoder{}
+	e.u32(8192)
+	e.str("9P2000.L")
+	d := c.rpc(p9Tversion, e)
+	if msize, version := d.u32(), d.str(); msize != 8192 || version != "9P2000.L" {
+		t.Fatalf("wrong version reply: %v %v", msize, version)
+	}
+
+	e = &p9Encoder{}
+	e.u32(0)
+	e.u32(^uint32(0))
+	e.str("user")
+	e.str("")
+	e.u32(0)
+	c.rpc(p9Tattach, e)
+
+	return c
+}
+
+// call sends a request and returns the reply, or the error number for Rlerror.
+func (c *p9Client) call(typ uint8, e *p9Encoder) (*p9Decoder, uint32) {
+	msg := make([]byte, p9HeaderSize)
+	binary.LittleEndian.PutUint32(msg, uint32(p9HeaderSize+len(e.buf)))
+	msg[4] = typ
+	binary.LittleEndian.PutUint16(msg[5:], 1)
+	msg = append(msg, e.buf...)
+
+	_, err := c.conn.Write(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	var hdr [p9HeaderSize]byte
+	_, err = io.ReadFull(c.conn, hdr[:])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	buf := make([]byte, binary.LittleEndian.Uint32(hdr[:])-p9HeaderSize)
+	_, err = io.ReadFull(c.conn, buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	d := &p9Decoder{buf: buf}
+	if hdr[4] == p9Rlerror {
+		return nil, d.u32()
+	}
+
+	if hdr[4] != typ+1 {
+		c.t.Fatalf("wrong reply type %v for %v", hdr[4], typ)
+	}
+
+	return d, 0
+}
+
+// rpc is like call, but fails the test for Rlerror.
+func (c *p9Client) rpc(typ uint8, e *p9Encoder) *p9Decoder {
+	d, errno := c.call(typ, e)
+	if errno != 0 {
+		c.t.Fatalf("request %v failed: errno %v", typ, errno)
+	}
+
+	return d
+}
+
+// walk walks from the root to p and returns the error number.
+func (c *p9Client) walk(newfid uint32, p string) uint32 {
+	e := &p9Encoder{}
+	e.u32(0)
+	e.u32(newfid)
+	names := strings.Split(strings.Trim(p, "/"), "/")
+	if p == "/" {
+		names = nil
+	}
+	e.u16(uint16(len(names)))
+	for _, name := range names {
+		e.str(name)
+	}
+
+	d, errno := c.call(p9Twalk, e)
+	if errno == 0 && int(d.u16()) != len(names) {
+		return p9ENOENT
+	}
+
+	return errno
+}
+
+func (c *p9Client) open(fid uint32, flags uint32) uint32 {
+	e := &p9Encoder{}
+	e.u32(fid)
+	e.u32(flags)
+	_, errno := c.call(p9Tlopen, e)
+	return errno
+}
+
+func (c *p9Client) readAll(fid uint32) []byte {
+	var buf []byte
+	for {
+		e := &p9Encoder{}
+		e.u32(fid)
+		e.u64(uint64(len(buf)))
+		e.u32(4096)
+		d := c.rpc(p9Tread, e)
+		data := d.next(int(d.u32()))
+		if len(data) == 0 {
+			return buf
+		}
+		buf = append(buf, data...)
+	}
+}
+
+func (c *p9Client) readdir(fid uint32) (names []string) {
+	offset := uint64(0)
+	for {
+		e := &p9Encoder{}
+		e.u32(fid)
+		e.u64(offset)
+		e.u32(100)
+		d := c.rpc(p9Treaddir, e)
+		d = &p9Decoder{buf: d.next(int(d.u32()))}
+		if len(d.buf) == 0 {
+			return names
+		}
+
+		for len(d.buf) > 0 {
+			d.next(13)
+			offset = d.u64()
+			d.u8()
+			names = append(names, d.str())
+		}
+	}
+}
+
+func TestNinePServer(t *testing.T) {
+	tree := newTestTree()
+	c := newP9Client(t, tree)
+
+	var file, dir, link string
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		switch fi.entry.Type {
+		case fuseutil.DT_File:
+			file = p
+		case fuseutil.DT_Directory:
+			dir = p
+		case fuseutil.DT_Link:
+			link = p
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// read a file
+	if errno := c.walk(1, file); errno != 0 {
+		t.Fatalf("walk to %v failed: %v", file, errno)
+	}
+
+	e := &p9Encoder{}
+	e.u32(1)
+	e.u64(p9GetattrBasic)
+	d := c.rpc(p9Tgetattr, e)
+	fi, err := tree.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.u64()
+	if d.next(13); d.u32() != unixMode(fi.Mode()) {
+		t.Errorf("wrong mode")
+	}
+	d.u32()
+	d.u32()
+	d.u64()
+	d.u64()
+	if size := d.u64(); size != uint64(fi.Size()) {
+		t.Errorf("wrong size %v, want %v", size, fi.Size())
+	}
+
+	if errno := c.open(1, 0); errno != 0 {
+		t.Fatalf("open failed: %v", errno)
+	}
+
+	rd, err := tree.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := rd.File().ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf := c.readAll(1); !bytes.Equal(buf, want) {
+		t.Errorf("wrong content for %v, got %d bytes, want %d", file, len(buf), len(want))
+	}
+
+	// list a directory
+	if errno := c.walk(2, dir); errno != 0 {
+		t.Fatalf("walk to %v failed: %v", dir, errno)
+	}
+	if errno := c.open(2, 0); errno != 0 {
+		t.Fatalf("open failed: %v", errno)
+	}
+
+	d2, err := tree.OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantNames []string
+	for _, entry := range d2.Entries() {
+		wantNames = append(wantNames, entry.Name)
+	}
+	names := c.readdir(2)
+	sort.Strings(names)
+	sort.Strings(wantNames)
+	if strings.Join(names, " ") != strings.Join(wantNames, " ") {
+		t.Errorf("wrong entries for %v:\n  want %v\n  got  %v", dir, wantNames, names)
+	}
+
+	// read a symlink
+	if errno := c.walk(3, link); errno != 0 {
+		t.Fatalf("walk to %v failed: %v", link, errno)
+	}
+	e = &p9Encoder{}
+	e.u32(3)
+	linkFi, err := tree.Stat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target := c.rpc(p9Treadlink, e).str(); target != linkFi.Target() {
+		t.Errorf("wrong target %q, want %q", target, linkFi.Target())
+	}
+
+	// errors
+	if errno := c.walk(4, "/does-not-exist"); errno != p9ENOENT {
+		t.Errorf("walk to missing entry returned %v", errno)
+	}
+	if errno := c.walk(4, file+"/foo"); errno != p9ENOENT {
+		t.Errorf("walk below file returned %v", errno)
+	}
+	if errno := c.walk(4, file); errno != 0 {
+		t.Fatal(errno)
+	}
+	if errno := c.open(4, 2); errno != p9EROFS {
+		t.Errorf("open for writing returned %v", errno)
+	}
+
+	e = &p9Encoder{}
+	e.u32(0)
+	e.str("foo")
+	e.u32(0o755)
+	e.u32(0)
+	if _, errno := c.call(p9Tmkdir, e); errno != p9EROFS {
+		t.Errorf("mkdir returned %v", errno)
+	}
+
+	e = &p9Encoder{}
+	e.u32(42)
+	if _, errno := c.call(p9Tclunk, e); errno != p9EBADF {
+		t.Errorf("clunk of unknown fid returned %v", errno)
+	}
+
+	_ = c.conn.Close()
+}
+
+func TestNinePServerXattrs(t *testing.T) {
+	cfg := newTestTree().Config()
+	cfg.XattrsPerFile = 2
+	tree := NewTree(cfg)
+	c := newP9Client(t, tree)
+
+	var file string
+	var xattrs []Xattr
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		if fi.entry.Type == fuseutil.DT_File {
+			d, err := tree.OpenDir(p[:strings.LastIndex(p, "/")+1])
+			if err != nil {
+				return err
+			}
+			file, xattrs = p, d.EntryXattrs(fi.entry)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(xattrs) == 0 {
+		t.Fatal("no xattrs generated")
+	}
+
+	if errno := c.walk(1, file); errno != 0 {
+		t.Fatal(errno)
+	}
+
+	xattrwalk := func(name string) ([]byte, uint32) {
+		e := &p9Encoder{}
+		e.u32(1)
+		e.u32(2)
+		e.str(name)
+		d, errno := c.call(p9Txattrwalk, e)
+		if errno != 0 {
+			return nil, errno
+		}
+
+		size := d.u64()
+		buf := c.readAll(2)
+		if uint64(len(buf)) != size {
+			t.Errorf("wrong size %v for %d bytes", size, len(buf))
+		}
+
+		e = &p9Encoder{}
+		e.u32(2)
+		c.rpc(p9Tclunk, e)
+		return buf, 0
+	}
+
+	var names []string
+	for _, x := range xattrs {
+		names = append(names, x.Name)
+
+		value, errno := xattrwalk(x.Name)
+		if errno != 0 || !bytes.Equal(value, x.Value) {
+			t.Errorf("wrong value for %v: %v %q", x.Name, errno, value)
+		}
+	}
+
+	list, _ := xattrwalk("")
+	if string(list) != strings.Join(names, "\x00")+"\x00" {
+		t.Errorf("wrong list of names %q", list)
+	}
+
+	if _, errno := xattrwalk("user.missing"); errno != p9ENODATA {
+		t.Errorf("missing xattr returned %v", errno)
+	}
+
+	_ = c.conn.Close()
+}
+
+func TestNinePServerSparse(t *testing.T) {
+	cfg := newTestTree().Config()
+	cfg.SparseRate, cfg.HoleRate = 1, 0.5
+	tree := NewTree(cfg)
+	c := newP9Client(t, tree)
+
+	var file string
+	var blocks uint64
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		if fi.entry.Type != fuseutil.DT_File || file != "" {
+			return nil
+		}
+
+		rd, err := tree.Open(p)
+		if err != nil {
+			return err
+		}
+
+		if b := rd.File().Blocks(); b < uint64(fi.Size()+511)/512 {
+			file, blocks = p, b
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file == "" {
+		t.Fatal("no sparse file generated")
+	}
+
+	if errno := c.walk(1, file); errno != 0 {
+		t.Fatalf("walk to %v failed: %v", file, errno)
+	}
+
+	e := &p9Encoder{}
+	e.u32(1)
+	e.u64(p9GetattrBasic)
+	d := c.rpc(p9Tgetattr, e)
+
+	// skip valid, qid, mode, uid, gid, nlink, rdev, size and blksize
+	d.next(8 + 13 + 3*4 + 4*8)
+	if b := d.u64(); b != blocks {
+		t.Errorf("wrong number of blocks %v, want %v", b, blocks)
+	}
+}
@@ -0,0 +1,372 @@
+package fakedata
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// S3Handler serves a tree via a read-only subset of the S3 API: ListBuckets,
+// HeadBucket, GetBucketLocation, ListObjectsV2, HeadObject and GetObject.
+// The tree is a single bucket, the keys are the paths of the regular files
+// relative to the root of the tree. Only path-style requests are supported
+// and signatures are not checked, so any credentials work.
+type S3Handler struct {
+	Tree *Tree
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Workers is the number of goroutines generating the content of large
+	// and sequential reads, see FileReader.Workers.
+	Workers int
+}
+
+// maxKeys is the maximum number of keys returned by ListObjectsV2.
+const maxKeys = 1000
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3TimeFormat is the format for timestamps in S3 responses.
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// writeS3Error returns an S3 error response.
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_ = writeXML(w, s3Error{Code: code, Message: msg, Resource: r.URL.Path})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) error {
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (h *S3Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied", "the object store is read-only")
+		return
+	}
+
+	bucket, key := strings.TrimPrefix(r.URL.Path, "/"), ""
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket, key = bucket[:i], bucket[i+1:]
+	}
+
+	switch {
+	case bucket == "":
+		h.listBuckets(w, r)
+	case bucket != h.Bucket:
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+	case key != "":
+		h.getObject(w, r, key)
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case hasQuery(r, "location"):
+		_ = writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			NS      string   `xml:"xmlns,attr"`
+		}{NS: s3Namespace})
+	case r.URL.Query().Get("list-type") == "2":
+		h.listObjects(w, r)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported")
+	}
+}
+
+func hasQuery(r *http.Request, name string) bool {
+	_, ok := r.URL.Query()[name]
+	return ok
+}
+
+func (h *S3Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+
+	res := struct {
+		XMLName     xml.Name `xml:"ListAllMyBucketsResult"`
+		NS          string   `xml:"xmlns,attr"`
+		OwnerID     string   `xml:"Owner>ID"`
+		DisplayName string   `xml:"Owner>DisplayName"`
+		Buckets     []bucket `xml:"Buckets>Bucket"`
+	}{
+		NS:          s3Namespace,
+		OwnerID:     "fakedatafs",
+		DisplayName: "fakedatafs",
+		Buckets: []bucket{{
+			Name:         h.Bucket,
+			CreationDate: h.Tree.Root().Attributes().Mtime.UTC().Format(s3TimeFormat),
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = writeXML(w, res)
+}
+
+func (h *S3Handler) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	d, entry, ok, err := h.Tree.lookup("open", "/"+key)
+	if err != nil || !ok || entry.Type != fuseutil.DT_File || strings.HasSuffix(key, "/") {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "the key does not exist")
+		return
+	}
+
+	f := d.File(entry)
+	attr := d.EntryAttributes(entry)
+
+	w.Header().Set("ETag", etag(f))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+	rd := NewFileReader(f)
+	rd.Workers = h.Workers
+	rd.Limit = rangeEnd(r)
+	http.ServeContent(w, r, "", attr.Mtime, rd)
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name   `xml:"ListBucketResult"`
+	NS                    string     `xml:"xmlns,attr"`
+	Name                  string     `xml:"Name"`
+	Prefix                string     `xml:"Prefix"`
+	Delimiter             string     `xml:"Delimiter,omitempty"`
+	MaxKeys               int        `xml:"MaxKeys"`
+	KeyCount              int        `xml:"KeyCount"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string     `xml:"StartAfter,omitempty"`
+	Contents              []s3Object `xml:"Contents"`
+	CommonPrefixes        []s3Prefix `xml:"CommonPrefixes"`
+}
+
+func (h *S3Handler) listObjects(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res := listBucketResult{
+		NS:                s3Namespace,
+		Name:              h.Bucket,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+		StartAfter:        q.Get("start-after"),
+	}
+
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+			return
+		}
+
+		if n < maxKeys {
+			res.MaxKeys = n
+		}
+	}
+
+	l := &s3Lister{
+		prefix:    res.Prefix,
+		delimiter: res.Delimiter,
+		after:     res.StartAfter,
+		max:       res.MaxKeys,
+	}
+
+	if res.ContinuationToken != "" {
+		err := l.resume(res.ContinuationToken)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument", "invalid continuation token")
+			return
+		}
+	}
+
+	// like S3, an empty list which is not truncated is returned for zero
+	// max keys, so clients do not request more pages
+	if l.max > 0 {
+		err := l.walk(h.Tree.Root(), "")
+		if err != nil && err != errListFull {
+			writeS3Error(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+	}
+
+	res.Contents = l.contents
+	res.CommonPrefixes = l.prefixes
+	res.KeyCount = len(l.contents) + len(l.prefixes)
+	if l.truncated {
+		res.IsTruncated = true
+		res.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(l.next))
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = writeXML(w, res)
+}
+
+// errListFull is returned by s3Lister.walk when max keys have been found and
+// more are available.
+var errListFull = errors.New("list is full")
+
+// s3Lister collects the keys and common prefixes for ListObjectsV2 in
+// lexicographical order. Subtrees which cannot contain keys for the result
+// are not generated, so listing a page of a large tree is cheap.
+type s3Lister struct {
+	prefix, delimiter string
+	max               int
+
+	// after is the key after which the listing starts.
+	after string
+
+	// lastPrefix is the common prefix returned last, all keys starting with
+	// it are skipped.
+	lastPrefix string
+
+	contents  []s3Object
+	prefixes  []s3Prefix
+	truncated bool
+
+	// next is the continuation token, "k" followed by a key or "p" followed
+	// by a common prefix.
+	next string
+}
+
+// resume continues after the key or common prefix in the token.
+func (l *s3Lister) resume(token string) error {
+	buf, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+
+	s := string(buf)
+	switch {
+	case strings.HasPrefix(s, "k"):
+		l.after = s[1:]
+	case strings.HasPrefix(s, "p"):
+		l.after = s[1:]
+		l.lastPrefix = s[1:]
+	default:
+		return errors.New("invalid token")
+	}
+
+	return nil
+}
+
+// skip returns true if no keys of the listing can start with key. For
+// directories, key is the prefix of all keys within it.
+func (l *s3Lister) skip(key string, dir bool) bool {
+	if dir {
+		if !strings.HasPrefix(key, l.prefix) && !strings.HasPrefix(l.prefix, key) {
+			return true
+		}
+
+		// all keys in the subtree sort before after
+		if key < l.after && !strings.HasPrefix(l.after, key) {
+			return true
+		}
+	} else if !strings.HasPrefix(key, l.prefix) || key <= l.after {
+		return true
+	}
+
+	return l.lastPrefix != "" && strings.HasPrefix(key, l.lastPrefix)
+}
+
+func (l *s3Lister) walk(d *Dir, dirKey string) error {
+	entries := make([]DirEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		if entry.Type == fuseutil.DT_File || entry.Type == fuseutil.DT_Directory {
+			entries = append(entries, entry)
+		}
+	}
+
+	// sort by the keys, the keys for directories are prefixes ending in a slash
+	sortKey := func(entry DirEntry) string {
+		if entry.Type == fuseutil.DT_Directory {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortKey(entries[i]) < sortKey(entries[j])
+	})
+
+	for _, entry := range entries {
+		key := dirKey + sortKey(entry)
+		if l.skip(key, entry.Type == fuseutil.DT_Directory) {
+			continue
+		}
+
+		var err error
+		if entry.Type == fuseutil.DT_Directory {
+			err = l.walk(d.Subdir(entry), key)
+		} else {
+			err = l.add(key, d, entry)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// add adds the key to the result, or the common prefix for it.
+func (l *s3Lister) add(key string, d *Dir, entry DirEntry) error {
+	if len(l.contents)+len(l.prefixes) >= l.max {
+		l.truncated = true
+		return errListFull
+	}
+
+	if l.delimiter != "" {
+		rest := key[len(l.prefix):]
+		if i := strings.Index(rest, l.delimiter); i >= 0 {
+			p := l.prefix + rest[:i+len(l.delimiter)]
+			l.prefixes = append(l.prefixes, s3Prefix{Prefix: p})
+			l.lastPrefix = p
+			l.next = "p" + p
+			return nil
+		}
+	}
+
+	l.contents = append(l.contents, s3Object{
+		Key:          key,
+		LastModified: d.EntryAttributes(entry).Mtime.UTC().Format(s3TimeFormat),
+		ETag:         etag(d.File(entry)),
+		Size:         entry.Size,
+		StorageClass: "STANDARD",
+	})
+	l.next = "k" + key
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package fakedata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// listAll lists the bucket with ListObjectsV2, following continuation tokens.
+// Keys are returned as they are, common prefixes prefixed with "P:".
+func listAll(t *testing.T, h *S3Handler, prefix, delimiter, maxKeys string) []string {
+	var list []string
+	token := ""
+	for i := 0; i < 10000; i++ {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {delimiter}, "max-keys": {maxKeys}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		rec := httpRequest(t, h, "GET", "/bucket?"+q.Encode(), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list returned %v: %s", rec.Code, rec.Body)
+		}
+
+		var res listBucketResult
+		err := xml.Unmarshal(rec.Body.Bytes(), &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.KeyCount != len(res.Contents)+len(res.CommonPrefixes) {
+			t.Errorf("wrong KeyCount %v", res.KeyCount)
+		}
+
+		// contents and common prefixes are sorted separately, merge them
+		var page []string
+		for _, obj := range res.Contents {
+			page = append(page, obj.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			page = append(page, "P:"+p.Prefix)
+		}
+		sort.Slice(page, func(i, j int) bool {
+			return strings.TrimPrefix(page[i], "P:") < strings.TrimPrefix(page[j], "P:")
+		})
+		list = append(list, page...)
+
+		if !res.IsTruncated {
+			return list
+		}
+		token = res.NextContinuationToken
+	}
+
+	t.Fatal("listing did not finish")
+	return nil
+}
+
+// wantList returns the expected result of a listing for the keys.
+func wantList(keys []string, prefix, delimiter string) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		rest := key[len(prefix):]
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			p := "P:" + prefix + rest[:i+len(delimiter)]
+			if !seen[p] {
+				list = append(list, p)
+				seen[p] = true
+			}
+			continue
+		}
+
+		list = append(list, key)
+	}
+
+	return list
+}
+
+func TestS3ListObjects(t *testing.T) {
+	tree := newTestTree()
+	h := &S3Handler{Tree: tree, Bucket: "bucket"}
+
+	var keys []string
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		if fi.Mode().IsRegular() {
+			keys = append(keys, p[1:])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+
+	dir := keys[len(keys)-1][:strings.Index(keys[len(keys)-1], "/")+1]
+
+	for _, test := range []struct {
+		prefix, delimiter string
+	}{
+		{"", ""},
+		{"", "/"},
+		{"", "-"},
+		{"dir-", "/"},
+		{dir, ""},
+		{dir, "/"},
+		{dir + "file", "/"},
+		{"does-not-exist", ""},
+	} {
+		want := wantList(keys, test.prefix, test.delimiter)
+		for _, maxKeys := range []string{"1", "3", "1000"} {
+			list := listAll(t, h, test.prefix, test.delimiter, maxKeys)
+			if strings.Join(list, "\n") != strings.Join(want, "\n") {
+				t.Errorf("prefix %q, delimiter %q, max-keys %v: wrong result\n  want %v\n  got  %v",
+					test.prefix, test.delimiter, maxKeys, want, list)
+			}
+		}
+	}
+
+	// zero max keys returns an empty list which is not truncated
+	if list := listAll(t, h, "", "", "0"); len(list) != 0 {
+		t.Errorf("max-keys 0: wrong result %v", list)
+	}
+}
+
+func TestS3Objects(t *testing.T) {
+	tree := newTestTree()
+	h := &S3Handler{Tree: tree, Bucket: "bucket"}
+
+	var key string
+	var f *File
+	err := tree.Walk(func(p string, fi FileInfo) error {
+		if fi.Mode().IsRegular() && fi.Size() > 1000 && f == nil {
+			rd, err := tree.Open(p)
+			if err != nil {
+				return err
+			}
+			key, f = p[1:], rd.File()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dir string
+	for _, entry := range tree.Root().Entries() {
+		if entry.Type == fuseutil.DT_Directory {
+			dir = entry.Name
+		}
+	}
+
+	want, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httpRequest(t, h, "GET", "/bucket/"+key, nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Fatalf("wrong content: %v", rec.Code)
+	}
+
+	if rec.Header().Get("ETag") != etag(f) {
+		t.Errorf("wrong ETag %v", rec.Header().Get("ETag"))
+	}
+
+	rec = httpRequest(t, h, "HEAD", "/bucket/"+key, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag(f) || rec.Body.Len() != 0 {
+		t.Errorf("wrong response for HEAD: %v %v", rec.Code, rec.Header())
+	}
+
+	rec = httpRequest(t, h, "GET", "/bucket/"+key, map[string]string{"Range": "bytes=100-199"})
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), want[100:200]) {
+		t.Errorf("wrong response for range request: %v", rec.Code)
+	}
+
+	for _, test := range []struct {
+		method, target string
+		status         int
+		code           string
+	}{
+		{"GET", "/bucket/does-not-exist", http.StatusNotFound, "NoSuchKey"},
+		{"GET", "/bucket/" + dir, http.StatusNotFound, "NoSuchKey"},
+		{"GET", "/bucket/" + dir + "/", http.StatusNotFound, "NoSuchKey"},
+		{"GET", "/other/" + key, http.StatusNotFound, "NoSuchBucket"},
+		{"PUT", "/bucket/" + key, http.StatusForbidden, "AccessDenied"},
+		{"DELETE", "/bucket/" + key, http.StatusForbidden, "AccessDenied"},
+		{"GET", "/bucket", http.StatusNotImplemented, "NotImplemented"},
+		{"GET", "/bucket?list-type=2&max-keys=x", http.StatusBadRequest, "InvalidArgument"},
+		{"GET", "/bucket?list-type=2&continuation-token=x", http.StatusBadRequest, "InvalidArgument"},
+	} {
+		rec := httpRequest(t, h, test.method, test.target, nil)
+		var res s3Error
+		err := xml.Unmarshal(rec.Body.Bytes(), &res)
+		if rec.Code != test.status || err != nil || res.Code != test.code {
+			t.Errorf("%v %v: got %v %v, want %v %v", test.method, test.target, rec.Code, res.Code, test.status, test.code)
+		}
+	}
+
+	rec = httpRequest(t, h, "GET", "/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<Name>bucket</Name>") {
+		t.Errorf("wrong bucket list: %v %s", rec.Code, rec.Body)
+	}
+}
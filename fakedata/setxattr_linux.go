@@ -0,0 +1,8 @@
+package fakedata
+
+import "syscall"
+
+// setXattr sets the extended attribute name of the file filename.
+func setXattr(filename, name string, value []byte) error {
+	return syscall.Setxattr(filename, name, value, 0)
+}
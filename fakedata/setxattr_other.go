@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// setXattr sets the extended attribute name of the file filename.
+func setXattr(filename, name string, value []byte) error {
+	return errors.New("extended attributes are not supported on this platform")
+}
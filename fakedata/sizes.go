@@ -0,0 +1,237 @@
+package fakedata
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SizeDistribution returns file sizes according to some distribution.
+type SizeDistribution interface {
+	// Size returns the next size, using rnd as the only source of randomness.
+	Size(rnd *rand.Rand) int
+}
+
+// clamp restricts size to [min, max].
+func clamp(size, min, max int) int {
+	if size < min {
+		return min
+	}
+	if size > max {
+		return max
+	}
+	return size
+}
+
+// Uniform distributes sizes uniformly in [Min, Max).
+type Uniform struct {
+	Min, Max int
+}
+
+// Size returns the next size.
+func (u Uniform) Size(rnd *rand.Rand) int {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+
+	return u.Min + rnd.Intn(u.Max-u.Min)
+}
+
+// Fixed returns the same size for all files.
+type Fixed struct {
+	Value int
+}
+
+// Size returns the next size.
+func (f Fixed) Size(rnd *rand.Rand) int {
+	return f.Value
+}
+
+// LogNormal distributes sizes log-normally around Median, clamped to [Min,
+// Max]. Sigma is the standard deviation of the logarithm of the size.
+type LogNormal struct {
+	Min, Max int
+	Median   int
+	Sigma    float64
+}
+
+// Size returns the next size.
+func (l LogNormal) Size(rnd *rand.Rand) int {
+	v := math.Exp(math.Log(float64(l.Median)) + l.Sigma*rnd.NormFloat64())
+	if v > float64(l.Max) {
+		return l.Max
+	}
+
+	return clamp(int(v), l.Min, l.Max)
+}
+
+// Pareto distributes sizes according to a power law, so that most files are
+// close to Min and few files are very large. Lower values for Alpha yield
+// more large files. The sizes are capped at Max.
+type Pareto struct {
+	Min, Max int
+	Alpha    float64
+}
+
+// Size returns the next size.
+func (p Pareto) Size(rnd *rand.Rand) int {
+	xm := float64(p.Min)
+	if xm < 1 {
+		xm = 1
+	}
+
+	u := 1 - rnd.Float64()
+	v := xm / math.Pow(u, 1/p.Alpha)
+	if v > float64(p.Max) {
+		return p.Max
+	}
+
+	return clamp(int(v), p.Min, p.Max)
+}
+
+// Bucket is a bucket in a histogram. It contains all sizes up to (but not
+// including) Max which are larger than or equal to the Max of the previous
+// bucket.
+type Bucket struct {
+	Max    int
+	Weight float64
+}
+
+// Histogram distributes sizes according to the weights of the buckets, and
+// uniformly within each bucket.
+type Histogram struct {
+	Buckets []Bucket
+	total   float64
+}
+
+// NewHistogram returns a histogram for buckets.
+func NewHistogram(buckets []Bucket) (*Histogram, error) {
+	if len(buckets) == 0 {
+		return nil, errors.New("histogram has no buckets")
+	}
+
+	h := &Histogram{Buckets: append([]Bucket(nil), buckets...)}
+	sort.Slice(h.Buckets, func(i, j int) bool {
+		return h.Buckets[i].Max < h.Buckets[j].Max
+	})
+
+	for _, b := range h.Buckets {
+		if b.Weight < 0 {
+			return nil, fmt.Errorf("bucket %v has negative weight %v", b.Max, b.Weight)
+		}
+		h.total += b.Weight
+	}
+
+	if h.total <= 0 {
+		return nil, errors.New("histogram has no weight")
+	}
+
+	return h, nil
+}
+
+// Size returns the next size.
+func (h *Histogram) Size(rnd *rand.Rand) int {
+	r := rnd.Float64() * h.total
+	min := 0
+	for i, b := range h.Buckets {
+		if r < b.Weight || i == len(h.Buckets)-1 {
+			return Uniform{Min: min, Max: b.Max}.Size(rnd)
+		}
+
+		r -= b.Weight
+		min = b.Max
+	}
+
+	panic("unreachable")
+}
+
+// ReadHistogram parses a histogram from rd. Each line contains the upper
+// bound of a bucket (see ParseSize) and its weight, separated by white space.
+// Empty lines and lines starting with # are ignored.
+func ReadHistogram(rd io.Reader) (*Histogram, error) {
+	var buckets []Bucket
+	sc := bufio.NewScanner(rd)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want two fields, got %d", line, len(fields))
+		}
+
+		max, err := ParseSize(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		buckets = append(buckets, Bucket{Max: max, Weight: weight})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewHistogram(buckets)
+}
+
+// LoadHistogram reads a histogram from the file filename.
+func LoadHistogram(filename string) (*Histogram, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := ReadHistogram(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	return h, nil
+}
+
+// ParseSize parses a size in bytes with an optional suffix K, M, G or T (for
+// KiB, MiB, GiB and TiB).
+func ParseSize(s string) (int, error) {
+	mult := 1
+	if len(s) > 0 {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			mult = 1 << 10
+		case "M":
+			mult = 1 << 20
+		case "G":
+			mult = 1 << 30
+		case "T":
+			mult = 1 << 40
+		}
+	}
+
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return v * mult, nil
+}
@@ -0,0 +1,109 @@
+package fakedata
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var sizeDistributionTests = []struct {
+	dist     SizeDistribution
+	min, max int
+}{
+	{Uniform{Min: 0, Max: 100 * 1024}, 0, 100 * 1024},
+	{Uniform{Min: 5000, Max: 6000}, 5000, 6000},
+	{Fixed{Value: 1234}, 1234, 1234},
+	{LogNormal{Min: 10, Max: 1 << 30, Median: 16 * 1024, Sigma: 2}, 10, 1 << 30},
+	{Pareto{Min: 1024, Max: 1 << 30, Alpha: 1.2}, 1024, 1 << 30},
+}
+
+func TestSizeDistributions(t *testing.T) {
+	for i, test := range sizeDistributionTests {
+		rnd1 := rand.New(rand.NewSource(23))
+		rnd2 := rand.New(rand.NewSource(23))
+
+		for j := 0; j < 1000; j++ {
+			size := test.dist.Size(rnd1)
+			if size < test.min || size > test.max {
+				t.Fatalf("test %d: size %d out of range [%d, %d]", i, size, test.min, test.max)
+			}
+
+			if size2 := test.dist.Size(rnd2); size != size2 {
+				t.Fatalf("test %d: distribution is not deterministic: %d != %d", i, size, size2)
+			}
+		}
+	}
+}
+
+func TestUniformCompatible(t *testing.T) {
+	rnd1 := rand.New(rand.NewSource(23))
+	rnd2 := rand.New(rand.NewSource(23))
+
+	u := Uniform{Max: 100 * 1024}
+	for i := 0; i < 100; i++ {
+		if u.Size(rnd1) != rnd2.Intn(100*1024) {
+			t.Fatalf("uniform distribution without minimum returns different sizes")
+		}
+	}
+}
+
+func TestLogNormalMedian(t *testing.T) {
+	rnd := rand.New(rand.NewSource(23))
+	dist := LogNormal{Max: 1 << 30, Median: 16 * 1024, Sigma: 1.5}
+
+	sizes := make([]int, 10001)
+	for i := range sizes {
+		sizes[i] = dist.Size(rnd)
+	}
+
+	sort.Ints(sizes)
+	median := sizes[len(sizes)/2]
+	if median < 14*1024 || median > 18*1024 {
+		t.Errorf("median %d is too far off", median)
+	}
+}
+
+var testHistogram = `
+# size weight
+4K   80
+1M   15
+
+1G   5
+`
+
+func TestHistogram(t *testing.T) {
+	h, err := ReadHistogram(strings.NewReader(testHistogram))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := rand.New(rand.NewSource(23))
+	var small, medium, large int
+	for i := 0; i < 10000; i++ {
+		size := h.Size(rnd)
+		switch {
+		case size < 4096:
+			small++
+		case size < 1<<20:
+			medium++
+		case size < 1<<30:
+			large++
+		default:
+			t.Fatalf("size %d out of range", size)
+		}
+	}
+
+	if small < 7500 || small > 8500 || medium < 1200 || medium > 1800 || large < 300 || large > 700 {
+		t.Errorf("unexpected distribution: %d small, %d medium, %d large", small, medium, large)
+	}
+}
+
+func TestReadHistogramInvalid(t *testing.T) {
+	for _, s := range []string{"", "4K", "4X 10", "4K ten", "4K -1\n8K 2", "4K 0"} {
+		_, err := ReadHistogram(strings.NewReader(s))
+		if err == nil {
+			t.Errorf("expected error for histogram %q not found", s)
+		}
+	}
+}
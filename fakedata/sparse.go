@@ -0,0 +1,88 @@
+package fakedata
+
+import (
+	"math/rand"
+	"syscall"
+)
+
+// These values for whence in Seek correspond to SEEK_DATA and SEEK_HOLE on
+// Linux.
+const (
+	SeekData = 3
+	SeekHole = 4
+)
+
+// punchHoles turns a fraction HoleRate of the segments of f into holes if the
+// file is selected as one of the SparseRate sparse files.
+func (cfg *Config) punchHoles(f *File) {
+	if cfg.SparseRate <= 0 {
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(f.Seed, "sparse")))
+	if rnd.Float64() >= cfg.SparseRate {
+		return
+	}
+
+	for i := range f.Segments {
+		if rnd.Float64() < cfg.HoleRate {
+			f.Segments[i].Hole = true
+		}
+	}
+}
+
+// Allocated returns the number of bytes of f which are not within holes.
+func (f File) Allocated() int64 {
+	var n int64
+	for _, seg := range f.Segments {
+		if !seg.Hole {
+			n += int64(seg.Size)
+		}
+	}
+
+	return n
+}
+
+// Blocks returns the number of 512 byte blocks allocated for f.
+func (f File) Blocks() uint64 {
+	return uint64(f.Allocated()+511) / 512
+}
+
+// seekHole returns the offset of the next data (hole is false) or hole (hole
+// is true) at or after off. The end of the file is treated as a hole.
+func (f File) seekHole(off int64, hole bool) (int64, error) {
+	if off < 0 || off >= int64(f.Size) {
+		return 0, syscall.ENXIO
+	}
+
+	pos := int64(0)
+	for _, seg := range f.Segments {
+		end := pos + int64(seg.Size)
+		if end > off && seg.Hole == hole {
+			if pos < off {
+				return off, nil
+			}
+			return pos, nil
+		}
+		pos = end
+	}
+
+	if hole {
+		return int64(f.Size), nil
+	}
+
+	return 0, syscall.ENXIO
+}
+
+// SeekData returns the offset of the next byte of data at or after off, as
+// lseek with SEEK_DATA does. If there is no more data, syscall.ENXIO is
+// returned.
+func (f File) SeekData(off int64) (int64, error) {
+	return f.seekHole(off, false)
+}
+
+// SeekHole returns the offset of the next hole at or after off, as lseek with
+// SEEK_HOLE does. The end of the file is considered a hole.
+func (f File) SeekHole(off int64) (int64, error) {
+	return f.seekHole(off, true)
+}
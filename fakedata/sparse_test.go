@@ -0,0 +1,114 @@
+package fakedata
+
+import (
+	"syscall"
+	"testing"
+)
+
+func testSparseFile() *File {
+	f := NewFile(23, 20<<20, 0)
+	for i := range f.Segments {
+		f.Segments[i].Hole = i%2 == 1
+	}
+	return f
+}
+
+func TestSparseFileContent(t *testing.T) {
+	f := testSparseFile()
+	buf, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos := 0
+	for _, seg := range f.Segments {
+		zeros := 0
+		for _, b := range buf[pos : pos+seg.Size] {
+			if b == 0 {
+				zeros++
+			}
+		}
+
+		if seg.Hole && zeros != seg.Size {
+			t.Errorf("hole at %d contains data", pos)
+		}
+
+		if !seg.Hole && zeros == seg.Size {
+			t.Errorf("data at %d only contains null bytes", pos)
+		}
+
+		pos += seg.Size
+	}
+
+	if f.Allocated() >= int64(f.Size) || f.Blocks() >= uint64(f.Size)/512 {
+		t.Errorf("sparse file has too many blocks allocated: %d of %d bytes", f.Allocated(), f.Size)
+	}
+}
+
+func TestSeekDataHole(t *testing.T) {
+	f := testSparseFile()
+	seg0, seg1 := int64(f.Segments[0].Size), int64(f.Segments[1].Size)
+
+	var tests = []struct {
+		whence int
+		off    int64
+		want   int64
+	}{
+		{SeekData, 0, 0},
+		{SeekData, 10, 10},
+		{SeekHole, 0, seg0},
+		{SeekHole, seg0 + 5, seg0 + 5},
+		{SeekData, seg0, seg0 + seg1},
+		{SeekData, seg0 + seg1 - 1, seg0 + seg1},
+	}
+
+	for i, test := range tests {
+		pos, err := f.Seek(test.off, test.whence)
+		if err != nil {
+			t.Errorf("test %d: unexpected error %v", i, err)
+			continue
+		}
+
+		if pos != test.want {
+			t.Errorf("test %d: want offset %d, got %d", i, test.want, pos)
+		}
+	}
+
+	_, err := f.SeekData(int64(f.Size))
+	if err != syscall.ENXIO {
+		t.Errorf("want ENXIO at end of file, got %v", err)
+	}
+
+	last := f.Segments[len(f.Segments)-1]
+	lastStart := int64(f.Size - last.Size)
+	pos, err := f.SeekHole(lastStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := lastStart
+	if !last.Hole {
+		want = int64(f.Size)
+	}
+
+	if pos != want {
+		t.Errorf("want hole at %d, got %d", want, pos)
+	}
+}
+
+func TestPunchHoles(t *testing.T) {
+	cfg := Config{Seed: 23, MaxSize: 20 << 20, FilesPerDir: 20, SparseRate: 0.5, HoleRate: 0.5}
+	d := NewDir(&cfg, 23, "/", 0)
+
+	sparse := 0
+	for _, entry := range d.entries {
+		f := d.File(entry)
+		if f.Allocated() < int64(f.Size) {
+			sparse++
+		}
+	}
+
+	if sparse == 0 || sparse == len(d.entries) {
+		t.Errorf("want some sparse files, got %d of %d", sparse, len(d.entries))
+	}
+}
@@ -0,0 +1,630 @@
+package fakedata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// Spec describes a tree in a file. All settings which are not given in the
+// spec keep the value from the configuration the spec is applied to.
+type Spec struct {
+	Seed          *int64 `json:"seed,omitempty"`
+	FormatVersion *int   `json:"format_version,omitempty"`
+	Generation    *int   `json:"generation,omitempty"`
+	DupPoolSize   *int   `json:"dup_pool_size,omitempty"`
+
+	// DirSpec contains the settings for the root directory.
+	DirSpec
+}
+
+// DirSpec contains the settings for a directory. They are inherited by all
+// subdirectories, unless a subdirectory in Paths overrides them.
+type DirSpec struct {
+	FilesPerDir *int `json:"files_per_dir,omitempty"`
+	DirsPerDir  *int `json:"dirs_per_dir,omitempty"`
+
+	// Depth is the number of nested directory levels generated below the
+	// directory.
+	Depth *int `json:"depth,omitempty"`
+
+	Sizes           *SizeSpec `json:"sizes,omitempty"`
+	Contents        []string  `json:"contents,omitempty"`
+	Compressibility *float64  `json:"compressibility,omitempty"`
+
+	SymlinksPerDir  *int `json:"symlinks_per_dir,omitempty"`
+	HardlinksPerDir *int `json:"hardlinks_per_dir,omitempty"`
+	SpecialPerDir   *int `json:"special_per_dir,omitempty"`
+
+	DupRate     *float64 `json:"dup_rate,omitempty"`
+	DupFileRate *float64 `json:"dup_file_rate,omitempty"`
+	SparseRate  *float64 `json:"sparse_rate,omitempty"`
+	HoleRate    *float64 `json:"hole_rate,omitempty"`
+	ChangeRate  *float64 `json:"change_rate,omitempty"`
+
+	VolatileRate *float64 `json:"volatile_rate,omitempty"`
+
+	MtimeRange      string   `json:"mtime_range,omitempty"`
+	Uids            string   `json:"uids,omitempty"`
+	Gids            string   `json:"gids,omitempty"`
+	Modes           string   `json:"modes,omitempty"`
+	SpecialBitsRate *float64 `json:"special_bits_rate,omitempty"`
+	UnreadableRate  *float64 `json:"unreadable_rate,omitempty"`
+
+	XattrsPerFile  *int     `json:"xattrs_per_file,omitempty"`
+	XattrMaxSize   *int     `json:"xattr_max_size,omitempty"`
+	CapabilityRate *float64 `json:"capability_rate,omitempty"`
+	ACLRate        *float64 `json:"acl_rate,omitempty"`
+
+	// Paths lists entries which are created in addition to the generated
+	// ones, relative to the directory.
+	Paths []PathSpec `json:"paths,omitempty"`
+}
+
+// PathSpec describes an entry at a fixed path. Missing parent directories
+// are created, they only contain the entries listed in the spec. The
+// settings in DirSpec apply to directories only.
+type PathSpec struct {
+	Path string `json:"path"`
+
+	// Type is one of file (the default), dir, symlink, fifo, chardev,
+	// blockdev or socket.
+	Type string `json:"type,omitempty"`
+
+	// Size and Content are used for files. If they are not set, they are
+	// selected like for generated files.
+	Size    *ByteSize `json:"size,omitempty"`
+	Content string    `json:"content,omitempty"`
+
+	// Target is the target of a symlink.
+	Target string `json:"target,omitempty"`
+
+	// Mode (octal), Mtime (see ParseTimeRange), Uid and Gid override the
+	// generated attributes.
+	Mode  string  `json:"mode,omitempty"`
+	Mtime string  `json:"mtime,omitempty"`
+	Uid   *uint32 `json:"uid,omitempty"`
+	Gid   *uint32 `json:"gid,omitempty"`
+
+	DirSpec
+}
+
+// SizeSpec describes a size distribution, see the --size-* options.
+type SizeSpec struct {
+	Distribution string   `json:"distribution"`
+	Min          ByteSize `json:"min,omitempty"`
+	Max          ByteSize `json:"max,omitempty"`
+	Median       ByteSize `json:"median,omitempty"`
+	Sigma        float64  `json:"sigma,omitempty"`
+	Alpha        float64  `json:"alpha,omitempty"`
+
+	// Histogram lists the buckets for the histogram distribution, which
+	// can also be loaded from HistogramFile.
+	Histogram     []BucketSpec `json:"histogram,omitempty"`
+	HistogramFile string       `json:"histogram_file,omitempty"`
+}
+
+// BucketSpec is a bucket of a histogram, see Bucket.
+type BucketSpec struct {
+	Max    ByteSize `json:"max"`
+	Weight float64  `json:"weight"`
+}
+
+// ByteSize is a size in bytes. In JSON, it is either a number or a string
+// as accepted by ParseSize.
+type ByteSize int
+
+// UnmarshalJSON parses a size.
+func (s *ByteSize) UnmarshalJSON(buf []byte) error {
+	var str string
+	if err := json.Unmarshal(buf, &str); err != nil {
+		var n int
+		if err := json.Unmarshal(buf, &n); err != nil {
+			return fmt.Errorf("invalid size %s", buf)
+		}
+		*s = ByteSize(n)
+		return nil
+	}
+
+	n, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+
+	*s = ByteSize(n)
+	return nil
+}
+
+// distribution returns the size distribution described by s. Sizes without
+// an upper bound are limited to max.
+func (s *SizeSpec) distribution(max int) (SizeDistribution, error) {
+	min := int(s.Min)
+	if s.Max > 0 {
+		max = int(s.Max)
+	}
+
+	if min > max {
+		return nil, fmt.Errorf("minimal size %v is larger than maximal size %v", min, max)
+	}
+
+	switch s.Distribution {
+	case "", "uniform":
+		return Uniform{Min: min, Max: max}, nil
+	case "fixed":
+		return Fixed{Value: max}, nil
+	case "lognormal":
+		l := LogNormal{Min: min, Max: max, Median: int(s.Median), Sigma: s.Sigma}
+		if l.Median == 0 {
+			l.Median = 16 * 1024
+		}
+		if l.Sigma == 0 {
+			l.Sigma = 2
+		}
+		return l, nil
+	case "pareto":
+		p := Pareto{Min: min, Max: max, Alpha: s.Alpha}
+		if p.Alpha == 0 {
+			p.Alpha = 1.2
+		}
+		if p.Alpha < 0 {
+			return nil, fmt.Errorf("invalid shape parameter %v for pareto distribution", p.Alpha)
+		}
+		return p, nil
+	case "histogram":
+		if s.HistogramFile != "" {
+			return LoadHistogram(s.HistogramFile)
+		}
+
+		buckets := make([]Bucket, 0, len(s.Histogram))
+		for _, b := range s.Histogram {
+			buckets = append(buckets, Bucket{Max: int(b.Max), Weight: b.Weight})
+		}
+		return NewHistogram(buckets)
+	}
+
+	return nil, fmt.Errorf("unknown size distribution %q", s.Distribution)
+}
+
+// apply changes cfg according to the settings in s. Paths are not handled.
+func (s *DirSpec) apply(cfg *Config) (err error) {
+	setInt := func(dst *int, src *int) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setFloat := func(dst *float64, src *float64) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setInt(&cfg.FilesPerDir, s.FilesPerDir)
+	setInt(&cfg.DirsPerDir, s.DirsPerDir)
+	setInt(&cfg.Depth, s.Depth)
+	setInt(&cfg.SymlinksPerDir, s.SymlinksPerDir)
+	setInt(&cfg.HardlinksPerDir, s.HardlinksPerDir)
+	setInt(&cfg.SpecialPerDir, s.SpecialPerDir)
+	setInt(&cfg.XattrsPerFile, s.XattrsPerFile)
+	setInt(&cfg.XattrMaxSize, s.XattrMaxSize)
+
+	setFloat(&cfg.Compressibility, s.Compressibility)
+	setFloat(&cfg.DupRate, s.DupRate)
+	setFloat(&cfg.DupFileRate, s.DupFileRate)
+	setFloat(&cfg.SparseRate, s.SparseRate)
+	setFloat(&cfg.HoleRate, s.HoleRate)
+	setFloat(&cfg.ChangeRate, s.ChangeRate)
+	setFloat(&cfg.VolatileRate, s.VolatileRate)
+	setFloat(&cfg.SpecialBitsRate, s.SpecialBitsRate)
+	setFloat(&cfg.UnreadableRate, s.UnreadableRate)
+	setFloat(&cfg.CapabilityRate, s.CapabilityRate)
+	setFloat(&cfg.ACLRate, s.ACLRate)
+
+	if s.Sizes != nil {
+		cfg.Sizes, err = s.Sizes.distribution(cfg.MaxSize)
+		if err != nil {
+			return err
+		}
+
+		if s.Sizes.Max > 0 {
+			cfg.MaxSize = int(s.Sizes.Max)
+		}
+	}
+
+	if len(s.Contents) > 0 {
+		cfg.Contents = make([]ContentKind, 0, len(s.Contents))
+		for _, name := range s.Contents {
+			kind, err := ParseContentKind(name)
+			if err != nil {
+				return err
+			}
+			cfg.Contents = append(cfg.Contents, kind)
+		}
+	}
+
+	if s.MtimeRange != "" {
+		cfg.MtimeMin, cfg.MtimeMax, err = ParseTimeRange(s.MtimeRange)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Uids != "" {
+		cfg.Uids, err = ParseIDs(s.Uids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Gids != "" {
+		cfg.Gids, err = ParseIDs(s.Gids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Modes != "" {
+		cfg.Modes, err = ParseModes(s.Modes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fixedAttrs are the attributes of an entry given in a spec.
+type fixedAttrs struct {
+	mode     os.FileMode
+	mtime    time.Time
+	uid, gid *uint32
+}
+
+// apply overrides the attributes in attr.
+func (a fixedAttrs) apply(attr *fuseops.InodeAttributes) {
+	if a.mode != 0 {
+		attr.Mode = attr.Mode&^PermBits | a.mode
+	}
+
+	if !a.mtime.IsZero() {
+		attr.Atime = a.mtime.Add(attr.Atime.Sub(attr.Mtime))
+		attr.Mtime = a.mtime
+		attr.Ctime = a.mtime
+		if attr.Crtime.After(a.mtime) {
+			attr.Crtime = a.mtime
+		}
+	}
+
+	if a.uid != nil {
+		attr.Uid = *a.uid
+	}
+
+	if a.gid != nil {
+		attr.Gid = *a.gid
+	}
+}
+
+// fixedEntry is an entry at a fixed path.
+type fixedEntry struct {
+	name string
+	typ  fuseutil.DirentType
+
+	// size is the size of a file, -1 selects a size from the distribution.
+	size int
+
+	content    ContentKind
+	hasContent bool
+
+	target string
+	attrs  fixedAttrs
+
+	// node contains the settings and entries of a directory.
+	node *specNode
+}
+
+// apply overrides the attributes in attr, e may be nil.
+func (e *fixedEntry) apply(attr *fuseops.InodeAttributes) {
+	if e != nil {
+		e.attrs.apply(attr)
+	}
+}
+
+// specNode is a directory with settings or fixed entries from a spec.
+type specNode struct {
+	cfg   *Config
+	depth int
+	attrs fixedAttrs
+
+	// implicit is set for parent directories of fixed paths which are not
+	// listed in the spec themselves, no entries are generated in them.
+	implicit bool
+
+	entries map[string]*fixedEntry
+}
+
+// find returns the node for the directory dir, n may be nil.
+func (n *specNode) find(dir string) *specNode {
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if n == nil || name == "" {
+			continue
+		}
+
+		entry, ok := n.entries[name]
+		if !ok {
+			return nil
+		}
+		n = entry.node
+	}
+
+	return n
+}
+
+// names returns the names of the fixed entries, sorted.
+func (n *specNode) names() []string {
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSpecNode returns the node for a directory with cfg and depth, with the
+// settings and paths from s.
+func newSpecNode(cfg Config, depth int, s *DirSpec) (*specNode, error) {
+	if s.Depth != nil {
+		depth = *s.Depth
+	}
+
+	err := s.apply(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &specNode{
+		cfg:     &cfg,
+		depth:   depth,
+		entries: make(map[string]*fixedEntry),
+	}
+
+	for _, p := range s.Paths {
+		err = n.add(p)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %v", p.Path, err)
+		}
+	}
+
+	return n, nil
+}
+
+// add adds the entry p relative to n.
+func (n *specNode) add(p PathSpec) error {
+	clean := path.Clean("/" + p.Path)
+	if clean == "/" {
+		return errors.New("empty path")
+	}
+
+	parts := strings.Split(clean[1:], "/")
+	for _, name := range parts[:len(parts)-1] {
+		parent, ok := n.entries[name]
+		if !ok {
+			parent = &fixedEntry{
+				name: name,
+				typ:  fuseutil.DT_Directory,
+				node: &specNode{
+					cfg:      n.cfg,
+					depth:    n.depth - 1,
+					implicit: true,
+					entries:  make(map[string]*fixedEntry),
+				},
+			}
+			n.entries[name] = parent
+		}
+
+		if parent.node == nil {
+			return fmt.Errorf("%v is not a directory", parent.name)
+		}
+		n = parent.node
+	}
+
+	entry, err := n.newEntry(parts[len(parts)-1], p)
+	if err != nil {
+		return err
+	}
+
+	existing, ok := n.entries[entry.name]
+	if ok {
+		if existing.node != nil && existing.node.implicit {
+			return errors.New("directory must be listed before its entries")
+		}
+		return errors.New("duplicate path")
+	}
+
+	n.entries[entry.name] = entry
+	return nil
+}
+
+// newEntry returns the fixed entry name in n described by p.
+func (n *specNode) newEntry(name string, p PathSpec) (*fixedEntry, error) {
+	entry := &fixedEntry{name: name, size: -1, target: p.Target}
+
+	switch p.Type {
+	case "", "file":
+		entry.typ = fuseutil.DT_File
+	case "dir":
+		entry.typ = fuseutil.DT_Directory
+	case "symlink":
+		entry.typ = fuseutil.DT_Link
+		if p.Target == "" {
+			return nil, errors.New("symlink without target")
+		}
+	default:
+		for _, t := range specialTypes {
+			if t.name == p.Type {
+				entry.typ = t.typ
+			}
+		}
+		if entry.typ == 0 {
+			return nil, fmt.Errorf("unknown type %q", p.Type)
+		}
+	}
+
+	if p.Size != nil {
+		entry.size = int(*p.Size)
+	}
+
+	if p.Content != "" {
+		kind, err := ParseContentKind(p.Content)
+		if err != nil {
+			return nil, err
+		}
+		entry.content, entry.hasContent = kind, true
+	}
+
+	if p.Mode != "" {
+		mode, err := strconv.ParseUint(p.Mode, 8, 32)
+		if err != nil || mode&^07777 != 0 {
+			return nil, fmt.Errorf("invalid mode %q", p.Mode)
+		}
+
+		entry.attrs.mode = os.FileMode(mode & 0777)
+		for i, bit := range []os.FileMode{os.ModeSticky, os.ModeSetgid, os.ModeSetuid} {
+			if mode&(01000<<uint(i)) != 0 {
+				entry.attrs.mode |= bit
+			}
+		}
+	}
+
+	if p.Mtime != "" {
+		mtime, err := parseTime(p.Mtime)
+		if err != nil {
+			return nil, err
+		}
+		entry.attrs.mtime = mtime
+	}
+
+	entry.attrs.uid, entry.attrs.gid = p.Uid, p.Gid
+
+	if entry.typ == fuseutil.DT_Directory {
+		node, err := newSpecNode(*n.cfg, n.depth-1, &p.DirSpec)
+		if err != nil {
+			return nil, err
+		}
+		node.attrs = entry.attrs
+		entry.node = node
+	}
+
+	return entry, nil
+}
+
+// ApplySpec returns cfg changed according to spec.
+func ApplySpec(cfg Config, spec *Spec) (Config, error) {
+	if spec.Seed != nil {
+		cfg.Seed = *spec.Seed
+	}
+
+	if spec.FormatVersion != nil {
+		err := CheckFormat(*spec.FormatVersion)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.FormatVersion = *spec.FormatVersion
+	}
+
+	if spec.Generation != nil {
+		cfg.Generation = *spec.Generation
+	}
+
+	if spec.DupPoolSize != nil {
+		cfg.DupPoolSize = *spec.DupPoolSize
+	}
+
+	root, err := newSpecNode(cfg, cfg.Depth, &spec.DirSpec)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg = *root.cfg
+	cfg.tree = root
+	return cfg, nil
+}
+
+// LoadSpec reads a spec in JSON format from the file filename.
+func LoadSpec(filename string) (*Spec, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+
+	var spec Spec
+	err = dec.Decode(&spec)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	return &spec, nil
+}
+
+// addFixed adds the fixed entries from the spec to d. Generated entries with
+// the same name are replaced.
+func (d *Dir) addFixed() {
+	if d.node == nil || len(d.node.entries) == 0 {
+		return
+	}
+
+	entries := d.entries[:0]
+	for _, entry := range d.entries {
+		if _, ok := d.node.entries[entry.Name]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+	d.entries = entries
+
+	for _, name := range d.node.names() {
+		fixed := d.node.entries[name]
+		p := path.Join(d.path, name)
+
+		entry := DirEntry{
+			Dirent: fuseutil.Dirent{
+				Name:  name,
+				Type:  fixed.typ,
+				Inode: d.cfg.inode(p),
+			},
+			Target: fixed.target,
+			fixed:  fixed,
+		}
+
+		switch fixed.typ {
+		case fuseutil.DT_Directory:
+			entry.Seed = d.cfg.seedForPath(d.seed, "dir", p)
+		case fuseutil.DT_File:
+			entry.Seed = d.cfg.seedForPath(d.seed, "file", p)
+			entry.ContentSeed = entry.Seed
+			entry.Size = fixed.size
+			if entry.Size < 0 {
+				rnd := rand.New(rand.NewSource(deriveSeed(entry.Seed, "size")))
+				entry.Size = d.cfg.size(rnd)
+			}
+			entry.BaseSize = entry.Size
+		default:
+			entry.Seed = d.cfg.seedForPath(d.seed, "fixed", p)
+		}
+
+		d.entries = append(d.entries, entry)
+	}
+}
@@ -0,0 +1,228 @@
+package fakedata
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// lookupPath returns the entry at p below root and the directory containing
+// it.
+func lookupPath(t testing.TB, root *Dir, p string) (*Dir, DirEntry) {
+	d := root
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i, name := range parts {
+		entry, ok := d.Lookup(name)
+		if !ok {
+			t.Fatalf("%v: %v not found in %v", p, name, d.path)
+		}
+
+		if i == len(parts)-1 {
+			return d, entry
+		}
+
+		if entry.Type != fuseutil.DT_Directory {
+			t.Fatalf("%v: %v is not a directory", p, name)
+		}
+		d = d.Subdir(entry)
+	}
+
+	panic("unreachable")
+}
+
+func loadExampleSpec(t testing.TB) Config {
+	spec, err := LoadSpec("../specs/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := ApplySpec(Config{Seed: 23, MaxSize: 100 * 1024, FilesPerDir: 100}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func count(d *Dir) (files, dirs int) {
+	for _, entry := range d.entries {
+		switch entry.Type {
+		case fuseutil.DT_File:
+			files++
+		case fuseutil.DT_Directory:
+			dirs++
+		}
+	}
+	return files, dirs
+}
+
+func TestSpecRoot(t *testing.T) {
+	cfg := loadExampleSpec(t)
+	if cfg.Seed != 42 {
+		t.Errorf("seed not applied, got %v", cfg.Seed)
+	}
+
+	root := NewDir(&cfg, cfg.Seed, "/", cfg.Depth)
+	files, dirs := count(root)
+
+	// the fixed directories etc, bin, dev, photos and src are added to the
+	// generated entries
+	if files != 20 || dirs != 3+5 {
+		t.Errorf("wrong number of entries in the root, got %d files and %d dirs", files, dirs)
+	}
+
+	if !reflect.DeepEqual(root.entries, NewDir(&cfg, cfg.Seed, "/", cfg.Depth).entries) {
+		t.Errorf("root is not deterministic")
+	}
+}
+
+func TestSpecFixedPaths(t *testing.T) {
+	cfg := loadExampleSpec(t)
+	root := NewDir(&cfg, cfg.Seed, "/", cfg.Depth)
+
+	d, hosts := lookupPath(t, root, "etc/hosts")
+	if hosts.Size != 120 {
+		t.Errorf("etc/hosts: wrong size %v", hosts.Size)
+	}
+
+	attr := d.cfg.entryAttributes(hosts)
+	if attr.Mode != 0644 || attr.Uid != 0 || attr.Gid != 0 {
+		t.Errorf("etc/hosts: wrong attributes %v %v:%v", attr.Mode, attr.Uid, attr.Gid)
+	}
+
+	if f := d.File(hosts); f.Content != ContentText || f.Size != 120 {
+		t.Errorf("etc/hosts: wrong file %v %v", f.Content, f.Size)
+	}
+
+	if files, dirs := count(d); files != 2 || dirs != 0 || len(d.entries) != 2 {
+		t.Errorf("etc: implicit directory contains %d entries", len(d.entries))
+	}
+
+	d, run := lookupPath(t, root, "bin/run")
+	attr = d.cfg.entryAttributes(run)
+	if attr.Mode != 0755|os.ModeSetuid {
+		t.Errorf("bin/run: wrong mode %v", attr.Mode)
+	}
+	if attr.Mtime.Format("2006-01-02") != "2019-06-01" {
+		t.Errorf("bin/run: wrong mtime %v", attr.Mtime)
+	}
+
+	d, sh := lookupPath(t, root, "bin/sh")
+	if sh.Type != fuseutil.DT_Link || d.cfg.entryAttributes(sh).Mode&os.ModeSymlink == 0 || sh.Target != "run" {
+		t.Errorf("bin/sh: wrong symlink %v -> %v", sh.Type, sh.Target)
+	}
+
+	d, pipe := lookupPath(t, root, "dev/pipe")
+	if d.cfg.entryAttributes(pipe).Mode&os.ModeNamedPipe == 0 {
+		t.Errorf("dev/pipe is not a fifo")
+	}
+}
+
+func TestSpecSubtree(t *testing.T) {
+	cfg := loadExampleSpec(t)
+	root := NewDir(&cfg, cfg.Seed, "/", cfg.Depth)
+
+	_, entry := lookupPath(t, root, "photos")
+	photos := root.Subdir(entry)
+	files, dirs := count(photos)
+	if files != 50 || dirs != 0 {
+		t.Errorf("photos: got %d files and %d dirs", files, dirs)
+	}
+
+	for _, entry := range photos.entries {
+		if entry.Size < 1<<20 || entry.Size > 8<<20 {
+			t.Errorf("photos/%v: size %v out of range", entry.Name, entry.Size)
+		}
+	}
+
+	_, entry = lookupPath(t, root, "src")
+	src := root.Subdir(entry)
+	if _, readme := lookupPath(t, src, "README"); readme.Size != 0 {
+		t.Errorf("src/README: wrong size %v", readme.Size)
+	}
+
+	// the settings are inherited by the generated subdirectories of src
+	levels := 0
+	for d := src; ; levels++ {
+		files, dirs := count(d)
+		if files != 10 && !(d == src && files == 11) {
+			t.Errorf("%v: got %d files", d.path, files)
+		}
+
+		for _, entry := range d.entries {
+			if entry.Type == fuseutil.DT_File && entry.fixed == nil && entry.Size >= 64*1024 {
+				t.Errorf("%v/%v: size %v out of range", d.path, entry.Name, entry.Size)
+			}
+		}
+
+		if dirs == 0 {
+			break
+		}
+
+		for _, entry := range d.entries {
+			if entry.Type == fuseutil.DT_Directory {
+				d = d.Subdir(entry)
+				break
+			}
+		}
+	}
+
+	if levels != 3 {
+		t.Errorf("src: want 3 levels of subdirectories, got %d", levels)
+	}
+}
+
+var invalidSpecs = []struct {
+	spec string
+	err  string
+}{
+	{`{"paths": [{"path": "a"}, {"path": "a"}]}`, "duplicate path"},
+	{`{"paths": [{"path": "a/b"}, {"path": "a", "type": "dir"}]}`, "must be listed before"},
+	{`{"paths": [{"path": "a"}, {"path": "a/b"}]}`, "not a directory"},
+	{`{"paths": [{"path": "a", "type": "pipe"}]}`, "unknown type"},
+	{`{"paths": [{"path": "a", "type": "symlink"}]}`, "without target"},
+	{`{"paths": [{"path": "/"}]}`, "empty path"},
+	{`{"paths": [{"path": "a", "mode": "999"}]}`, "invalid mode"},
+	{`{"contents": ["foo"]}`, "unknown content kind"},
+	{`{"sizes": {"distribution": "foo"}}`, "unknown size distribution"},
+	{`{"sizes": {"min": "2K", "max": "1K"}}`, "larger than"},
+	{`{"format_version": 99}`, "unknown format version"},
+}
+
+func TestSpecInvalid(t *testing.T) {
+	for _, test := range invalidSpecs {
+		var spec Spec
+		err := json.Unmarshal([]byte(test.spec), &spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ApplySpec(Config{}, &spec)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: want error %q, got %v", test.spec, test.err, err)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	var v struct {
+		A, B ByteSize
+	}
+
+	err := json.Unmarshal([]byte(`{"A": 123, "B": "4K"}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.A != 123 || v.B != 4096 {
+		t.Errorf("wrong sizes %v %v", v.A, v.B)
+	}
+
+	if err = json.Unmarshal([]byte(`{"A": "foo"}`), &v); err == nil {
+		t.Errorf("invalid size accepted")
+	}
+}
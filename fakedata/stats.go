@@ -0,0 +1,135 @@
+package fakedata
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// Stats contains statistics about a generated tree.
+type Stats struct {
+	Dirs     int
+	Files    int
+	Symlinks int
+	Special  int
+
+	// Bytes is the sum of the sizes of all files, UniqueBytes the number of
+	// bytes which remain when all duplicate data is removed.
+	Bytes       int64
+	UniqueBytes int64
+
+	// Allocated is the number of bytes not within holes of sparse files.
+	Allocated int64
+}
+
+// DuplicateRatio returns the fraction of duplicate data in the tree.
+func (s Stats) DuplicateRatio() float64 {
+	if s.Bytes == 0 {
+		return 0
+	}
+
+	return 1 - float64(s.UniqueBytes)/float64(s.Bytes)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d dirs, %d files, %d symlinks, %d special files, %d bytes, %d allocated, %d unique bytes, %.2f%% duplicate data",
+		s.Dirs, s.Files, s.Symlinks, s.Special, s.Bytes, s.Allocated, s.UniqueBytes, s.DuplicateRatio()*100)
+}
+
+// segmentKey identifies the data generated for a segment.
+type segmentKey struct {
+	Seed            int64
+	Content         ContentKind
+	Compressibility float64
+}
+
+type interval struct {
+	start, end int64
+}
+
+// TreeStats walks the tree below root and computes the statistics. Segments
+// which share the same seed are counted as duplicates where their data
+// overlaps, apart from that only null bytes are recognized as duplicate data.
+func TreeStats(root *Dir) (Stats, error) {
+	var stats Stats
+	data := make(map[segmentKey][]interval)
+	hardlinks := make(map[string]struct{})
+
+	err := root.Walk(func(dir *Dir, entry DirEntry) error {
+		switch entry.Type {
+		case fuseutil.DT_Directory:
+			stats.Dirs++
+			return nil
+		case fuseutil.DT_Link:
+			stats.Symlinks++
+			return nil
+		case fuseutil.DT_File:
+		default:
+			stats.Special++
+			return nil
+		}
+
+		stats.Files++
+		if entry.Nlink > 1 {
+			// count the data of files with several names only once
+			id := fmt.Sprintf("%s/%d", dir.path, entry.Inode)
+			if _, ok := hardlinks[id]; ok {
+				return nil
+			}
+			hardlinks[id] = struct{}{}
+		}
+
+		f := dir.File(entry)
+		stats.Allocated += f.Allocated()
+		for _, seg := range f.Segments {
+			stats.Bytes += int64(seg.Size)
+
+			key := segmentKey{Seed: seg.Seed, Content: seg.Content}
+			switch {
+			case seg.Hole, seg.Content == ContentZero:
+				key = segmentKey{Content: ContentZero}
+			case seg.Content == ContentCompressible:
+				key.Compressibility = seg.Compressibility
+			}
+
+			data[key] = append(data[key], interval{seg.Offset, seg.Offset + int64(seg.Size)})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	for key, list := range data {
+		if key.Content == ContentZero {
+			// all null bytes are contained in the longest segment
+			longest := int64(0)
+			for _, iv := range list {
+				if iv.end-iv.start > longest {
+					longest = iv.end - iv.start
+				}
+			}
+			stats.UniqueBytes += longest
+			continue
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].start < list[j].start
+		})
+
+		end := int64(-1)
+		for _, iv := range list {
+			if iv.start > end {
+				end = iv.start
+			}
+			if iv.end > end {
+				stats.UniqueBytes += iv.end - end
+				end = iv.end
+			}
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,409 @@
+package fakedata
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// Tree is the tree of fake data described by a Config. Directories and files
+// are generated when they are accessed, so the tree can be used without
+// mounting it and the memory usage does not depend on its size.
+type Tree struct {
+	cfg Config
+}
+
+// NewTree returns the tree described by cfg.
+func NewTree(cfg Config) *Tree {
+	return &Tree{cfg: cfg}
+}
+
+// Config returns the configuration of the tree.
+func (t *Tree) Config() Config {
+	return t.cfg
+}
+
+// Root generates the root directory.
+func (t *Tree) Root() *Dir {
+	return NewDir(&t.cfg, t.cfg.Seed, "/", t.cfg.Depth)
+}
+
+// FileInfo describes an entry of the tree. It implements os.FileInfo, Sys
+// returns the fuseops.InodeAttributes.
+type FileInfo struct {
+	name  string
+	attr  fuseops.InodeAttributes
+	entry DirEntry
+}
+
+// Name returns the base name of the entry.
+func (fi FileInfo) Name() string { return fi.name }
+
+// Size returns the size of a file or the length of the target of a symlink.
+func (fi FileInfo) Size() int64 { return int64(fi.attr.Size) }
+
+// Mode returns the type and permissions of the entry.
+func (fi FileInfo) Mode() os.FileMode { return fi.attr.Mode }
+
+// ModTime returns the modification time.
+func (fi FileInfo) ModTime() time.Time { return fi.attr.Mtime }
+
+// IsDir returns true for directories.
+func (fi FileInfo) IsDir() bool { return fi.attr.Mode.IsDir() }
+
+// Sys returns the attributes of the entry.
+func (fi FileInfo) Sys() interface{} { return fi.attr }
+
+// Inode returns the inode number of the entry.
+func (fi FileInfo) Inode() fuseops.InodeID { return fi.entry.Inode }
+
+// Target returns the target of a symlink.
+func (fi FileInfo) Target() string { return fi.entry.Target }
+
+// lookup returns the directory containing the entry at p and the entry. For
+// the root directory, only the directory is returned.
+func (t *Tree) lookup(op, p string) (*Dir, DirEntry, bool, error) {
+	p = path.Clean("/" + filepath.ToSlash(p))
+	d := t.Root()
+	if p == "/" {
+		return d, DirEntry{}, false, nil
+	}
+
+	names := strings.Split(p[1:], "/")
+	for i, name := range names {
+		entry, ok := d.Lookup(name)
+		if !ok {
+			return nil, DirEntry{}, false, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+		}
+
+		if i == len(names)-1 {
+			return d, entry, true, nil
+		}
+
+		if entry.Type != fuseutil.DT_Directory {
+			return nil, DirEntry{}, false, &os.PathError{Op: op, Path: p, Err: errors.New("not a directory")}
+		}
+
+		d = d.Subdir(entry)
+	}
+
+	panic("unreachable")
+}
+
+// Stat returns information about the entry at p, which is relative to the
+// root of the tree.
+func (t *Tree) Stat(p string) (FileInfo, error) {
+	d, entry, ok, err := t.lookup("stat", p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	if !ok {
+		root := DirEntry{Dirent: fuseutil.Dirent{Inode: fuseops.RootInodeID, Name: "/", Type: fuseutil.DT_Directory}, Seed: d.seed}
+		return FileInfo{name: "/", attr: d.Attributes(), entry: root}, nil
+	}
+
+	return FileInfo{name: entry.Name, attr: d.EntryAttributes(entry), entry: entry}, nil
+}
+
+// Open generates the file at p.
+func (t *Tree) Open(p string) (*FileReader, error) {
+	d, entry, ok, err := t.lookup("open", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok || entry.Type != fuseutil.DT_File {
+		return nil, &os.PathError{Op: "open", Path: p, Err: errors.New("not a regular file")}
+	}
+
+	return NewFileReader(d.File(entry)), nil
+}
+
+// OpenDir generates the directory at p.
+func (t *Tree) OpenDir(p string) (*Dir, error) {
+	d, entry, ok, err := t.lookup("open", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return d, nil
+	}
+
+	if entry.Type != fuseutil.DT_Directory {
+		return nil, &os.PathError{Op: "open", Path: p, Err: errors.New("not a directory")}
+	}
+
+	return d.Subdir(entry), nil
+}
+
+// Walk calls fn for all entries of the tree, depth first, with the path
+// relative to the root of the tree. If fn returns filepath.SkipDir for a
+// directory, its entries are skipped.
+func (t *Tree) Walk(fn func(p string, fi FileInfo) error) error {
+	return t.walk(t.Root(), fn)
+}
+
+func (t *Tree) walk(d *Dir, fn func(p string, fi FileInfo) error) error {
+	for _, entry := range d.entries {
+		var sub *Dir
+		fi := FileInfo{name: entry.Name, entry: entry}
+		if entry.Type == fuseutil.DT_Directory {
+			sub = d.Subdir(entry)
+			fi.attr = sub.Attributes()
+		} else {
+			fi.attr = d.cfg.entryAttributes(entry)
+		}
+
+		err := fn(path.Join(d.path, entry.Name), fi)
+		if err == filepath.SkipDir && sub != nil {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if sub != nil {
+			err = t.walk(sub, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FileReader reads the content of a generated file. It implements io.Reader,
+// io.ReaderAt and io.Seeker, including SeekData and SeekHole.
+type FileReader struct {
+	// Workers is the number of goroutines generating the content for reads
+	// of more than 2MiB, see File.ReadAtParallel. Once reads are sequential,
+	// the content is generated ahead in parallel, so reads with small
+	// buffers benefit as well.
+	Workers int
+
+	// Limit is the end of the range which is read, if it is positive.
+	// Content after it is not generated ahead.
+	Limit int64
+
+	f   *File
+	pos int64
+
+	// rd continues reading sequentially at rdPos.
+	rd    io.Reader
+	rdPos int64
+
+	// ahead is the content generated ahead starting at aheadPos, window is
+	// the amount generated ahead the last time.
+	ahead    []byte
+	aheadPos int64
+	window   int64
+
+	// last is the position after the previous read, seq is the number of
+	// reads in a row which started there.
+	last    int64
+	started bool
+	seq     int
+}
+
+const (
+	// readAheadAfter is the number of reads in a row which start where the
+	// previous one ended, before content is generated ahead.
+	readAheadAfter = 2
+
+	// readAheadFactor is the size of the content generated ahead the first
+	// time, as a multiple of the size of the read. It doubles every time
+	// more content is generated, up to maxReadAhead.
+	readAheadFactor = 4
+
+	// maxReadAhead is the maximal amount of content a FileReader generates
+	// ahead for sequential reads.
+	maxReadAhead = 16 * parallelChunkSize
+)
+
+// NewFileReader returns a reader for f.
+func NewFileReader(f *File) *FileReader {
+	return &FileReader{f: f}
+}
+
+// File returns the generated file.
+func (r *FileReader) File() *File {
+	return r.f
+}
+
+// Size returns the size of the file.
+func (r *FileReader) Size() int64 {
+	return int64(r.f.Size)
+}
+
+// Read reads the content at the current position.
+func (r *FileReader) Read(p []byte) (int, error) {
+	if r.pos >= r.Size() {
+		return 0, io.EOF
+	}
+
+	if r.started && r.pos == r.last {
+		r.seq++
+	} else {
+		r.seq, r.window = 0, 0
+	}
+	r.started = true
+
+	if r.Workers > 1 && len(p) >= 2*parallelChunkSize {
+		n, err := r.ReadAt(p, r.pos)
+		r.pos += int64(n)
+		r.last = r.pos
+		if err == io.EOF && n > 0 {
+			err = nil
+		}
+
+		return n, err
+	}
+
+	if r.Workers > 1 && r.f.Format != FormatV1 {
+		inside := r.pos >= r.aheadPos && r.pos < r.aheadPos+int64(len(r.ahead))
+		if !inside && r.seq >= readAheadAfter {
+			err := r.readAhead(len(p))
+			if err != nil {
+				return 0, err
+			}
+			inside = len(r.ahead) > 0
+		}
+
+		if inside {
+			n := copy(p, r.ahead[r.pos-r.aheadPos:])
+			r.pos += int64(n)
+			r.last = r.pos
+			return n, nil
+		}
+	}
+
+	if r.rd == nil || r.rdPos != r.pos {
+		r.rd = ContinuousFileReader(r.f, r.pos)
+		r.rdPos = r.pos
+	}
+
+	if int64(len(p)) > r.Size()-r.pos {
+		p = p[:r.Size()-r.pos]
+	}
+
+	n, err := io.ReadFull(r.rd, p)
+	r.pos += int64(n)
+	r.rdPos = r.pos
+	r.last = r.pos
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// readAhead generates the content at the current position for a read of n
+// bytes. The amount starts at a small multiple of n and doubles each time,
+// up to one chunk per worker, and never extends beyond Limit. Nothing is
+// generated at or after Limit.
+func (r *FileReader) readAhead(n int) error {
+	size := 2 * r.window
+	if min := int64(readAheadFactor * n); size < min {
+		size = min
+	}
+
+	max := int64(r.Workers) * parallelChunkSize
+	if max > maxReadAhead {
+		max = maxReadAhead
+	}
+	if size > max {
+		size = max
+	}
+	r.window = size
+
+	end := r.Size()
+	if r.Limit > 0 && r.Limit < end {
+		end = r.Limit
+	}
+	if size > end-r.pos {
+		size = end - r.pos
+	}
+
+	if size <= 0 {
+		r.ahead = r.ahead[:0]
+		return nil
+	}
+
+	if int64(cap(r.ahead)) < size {
+		r.ahead = make([]byte, size)
+	}
+	r.ahead = r.ahead[:size]
+
+	k, err := r.f.ReadAtParallel(r.ahead, r.pos, r.Workers)
+	r.ahead = r.ahead[:k]
+	r.aheadPos = r.pos
+	if err == io.EOF {
+		err = nil
+	}
+
+	return err
+}
+
+// ReadAt reads the content at the offset off. As required by io.ReaderAt, it
+// returns io.EOF if less than len(p) bytes are available.
+func (r *FileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if off >= r.Size() {
+		return 0, io.EOF
+	}
+
+	short := false
+	if int64(len(p)) > r.Size()-off {
+		p = p[:r.Size()-off]
+		short = true
+	}
+
+	n, err := r.f.ReadAtParallel(p, off, r.Workers)
+	if err == nil && short {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// Seek sets the position for the next Read.
+func (r *FileReader) Seek(offset int64, whence int) (int64, error) {
+	pos := r.pos
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos += offset
+	case io.SeekEnd:
+		pos = r.Size() + offset
+	case SeekData, SeekHole:
+		var err error
+		pos, err = r.f.seekHole(offset, whence == SeekHole)
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("invalid negative position in file")
+	}
+
+	r.pos = pos
+	return pos, nil
+}
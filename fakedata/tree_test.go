@@ -0,0 +1,313 @@
+package fakedata
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+func newTestTree() *Tree {
+	return NewTree(Config{
+		Seed: 23, MaxSize: 2 * maxSegmentSize, FilesPerDir: 5, DirsPerDir: 2, Depth: 2,
+		SymlinksPerDir: 1, SparseRate: 0.3,
+	})
+}
+
+func TestTreeWalk(t *testing.T) {
+	tree := newTestTree()
+
+	var want []string
+	err := tree.Root().Walk(func(d *Dir, entry DirEntry) error {
+		want = append(want, d.Path()+"|"+entry.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = tree.Walk(func(p string, fi FileInfo) error {
+		if n >= len(want) || filepath.Dir(p)+"|"+fi.Name() != want[n] {
+			t.Fatalf("unexpected entry %v", p)
+		}
+		n++
+
+		st, err := tree.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(st, fi) {
+			t.Errorf("%v: Stat returned %v, want %v", p, st, fi)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(want) {
+		t.Errorf("Walk returned %d entries, want %d", n, len(want))
+	}
+
+	// skip all subdirectories
+	n = 0
+	err = tree.Walk(func(p string, fi FileInfo) error {
+		n++
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(tree.Root().Entries()) {
+		t.Errorf("Walk returned %d entries with SkipDir, want %d", n, len(tree.Root().Entries()))
+	}
+}
+
+func TestTreeStat(t *testing.T) {
+	tree := newTestTree()
+
+	fi, err := tree.Stat("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fi.IsDir() || fi.Inode() != fuseops.RootInodeID {
+		t.Errorf("wrong info for root: %v", fi)
+	}
+
+	for _, p := range []string{"/does-not-exist", "/does/not/exist"} {
+		_, err = tree.Stat(p)
+		if !os.IsNotExist(err) {
+			t.Errorf("Stat(%v) returned %v", p, err)
+		}
+	}
+
+	var file string
+	for _, entry := range tree.Root().Entries() {
+		if entry.Type == fuseutil.DT_File {
+			file = entry.Name
+		}
+	}
+
+	_, err = tree.Stat(file + "/foo")
+	if err == nil || os.IsNotExist(err) {
+		t.Errorf("Stat below a file returned %v", err)
+	}
+
+	_, err = tree.Open("/")
+	if err == nil {
+		t.Errorf("Open of a directory succeeded")
+	}
+}
+
+func TestTreeOpen(t *testing.T) {
+	tree := newTestTree()
+
+	files := 0
+	err := tree.Root().Walk(func(d *Dir, entry DirEntry) error {
+		if entry.Type != fuseutil.DT_File {
+			return nil
+		}
+		files++
+
+		want, err := d.File(entry).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rd, err := tree.Open(d.Path() + "/" + entry.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, want) {
+			t.Errorf("%v: wrong content", entry.Name)
+		}
+
+		// a short read at the end returns io.EOF
+		if len(want) > 10 {
+			off := int64(len(want) - 10)
+			p := make([]byte, 20)
+			n, err := rd.ReadAt(p, off)
+			if n != 10 || err != io.EOF || !bytes.Equal(p[:n], want[off:]) {
+				t.Errorf("%v: ReadAt at the end returned %d, %v", entry.Name, n, err)
+			}
+		}
+
+		pos, err := rd.Seek(-5, io.SeekEnd)
+		if err != nil || pos != int64(len(want))-5 {
+			t.Errorf("%v: Seek returned %v, %v", entry.Name, pos, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files == 0 {
+		t.Fatalf("no files found")
+	}
+}
+
+func TestFileReaderWorkers(t *testing.T) {
+	f := NewFile(23, 9<<20+123, 0)
+	want, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := NewFileReader(f)
+	rd.Workers = 4
+
+	buf, err := ioutil.ReadAll(io.LimitReader(rd, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// large reads are generated in parallel
+	rest := make([]byte, 16<<20)
+	n, err := io.ReadFull(rd, rest)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+	buf = append(buf, rest[:n]...)
+
+	if !bytes.Equal(buf, want) {
+		t.Errorf("wrong content returned")
+	}
+
+	// small sequential reads are served from content generated ahead,
+	// also after seeking
+	for _, off := range []int64{0, 5<<20 + 17, 1 << 20} {
+		_, err = rd.Seek(off, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err = ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, want[off:]) {
+			t.Errorf("wrong content returned for sequential reads at %d", off)
+		}
+	}
+}
+
+func TestFileReaderRangeReads(t *testing.T) {
+	f := NewFile(23, 64<<20, 0)
+	rd := NewFileReader(f)
+	rd.Workers = 16
+
+	// random small ranges are not generated ahead
+	rand := rand.New(rand.NewSource(23))
+	for i := 0; i < 50; i++ {
+		off := rand.Int63n(int64(f.Size) - 64<<10)
+		_, err := rd.Seek(off, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 64<<10)
+		_, err = io.ReadFull(rd, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rd.ahead) > 0 {
+			t.Fatalf("content generated ahead for a single read at %d", off)
+		}
+	}
+
+	// sequential reads generate ahead, but only within the range
+	off, end := int64(3<<20+5), int64(7<<20+11)
+	want := make([]byte, end-off)
+	_, err := f.ReadAt(want, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd.Limit = end
+	_, err = rd.Seek(off, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	var window int64
+	buf := make([]byte, 32<<10)
+	for int64(len(got)) < end-off {
+		n, err := rd.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+
+		if rd.aheadPos+int64(len(rd.ahead)) > end {
+			t.Fatalf("content generated ahead beyond the range, up to %d", rd.aheadPos+int64(len(rd.ahead)))
+		}
+
+		// the window starts small and grows
+		if window == 0 && rd.window > readAheadFactor*int64(len(buf)) {
+			t.Fatalf("first window too large: %d", rd.window)
+		}
+		window = rd.window
+	}
+
+	if window == 0 {
+		t.Errorf("no content generated ahead for sequential reads")
+	}
+
+	if !bytes.Equal(got[:end-off], want) {
+		t.Errorf("wrong content returned for the range")
+	}
+}
+
+func BenchmarkFileReaderRangeReads(b *testing.B) {
+	f := NewFile(23, 1<<30, 0)
+	rd := NewFileReader(f)
+	rd.Workers = runtime.NumCPU()
+
+	rand := rand.New(rand.NewSource(23))
+	buf := make([]byte, 64<<10)
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		off := rand.Int63n(int64(f.Size) - int64(len(buf)))
+		rd.Limit = off + int64(len(buf))
+		_, err := rd.Seek(off, io.SeekStart)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// read like http.ServeContent does
+		_, err = io.CopyN(ioutil.Discard, rd, int64(len(buf)))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
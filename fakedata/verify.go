@@ -0,0 +1,221 @@
+package fakedata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// Difference is a difference between a directory and the generated tree.
+type Difference struct {
+	// Path is the path of the entry, relative to the root of the tree.
+	Path string
+
+	// Kind is one of missing, extra, type, size, mode, mtime, owner,
+	// target, content or error.
+	Kind string
+
+	// Message describes the difference.
+	Message string
+}
+
+func (d Difference) String() string {
+	if d.Message == "" {
+		return fmt.Sprintf("%-8s %v", d.Kind, d.Path)
+	}
+
+	return fmt.Sprintf("%-8s %v: %v", d.Kind, d.Path, d.Message)
+}
+
+// verifyBufferSize is the size of the chunks compared when verifying the
+// content of files.
+const verifyBufferSize = 1 << 20
+
+// Verifier compares a directory against a generated tree.
+type Verifier struct {
+	// Metadata enables comparing the permissions and modification times,
+	// Owner comparing the user and group IDs.
+	Metadata bool
+	Owner    bool
+
+	// Content enables comparing the content of files.
+	Content bool
+
+	// Report is called for each difference found.
+	Report func(Difference)
+
+	// Checked is the number of entries compared so far.
+	Checked int
+}
+
+// report calls v.Report for a difference.
+func (v *Verifier) report(p, kind, format string, args ...interface{}) {
+	if v.Report != nil {
+		v.Report(Difference{Path: p, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Verify compares the directory dir against the tree below root.
+func (v *Verifier) Verify(root *Dir, dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%v is not a directory", dir)
+	}
+
+	v.verifyDir(root, dir, "/")
+	return nil
+}
+
+// verifyDir compares the directory at the real path dir with d.
+func (v *Verifier) verifyDir(d *Dir, dir, rel string) {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		v.report(rel, "error", "%v", err)
+		return
+	}
+
+	real := make(map[string]os.FileInfo, len(list))
+	for _, fi := range list {
+		real[fi.Name()] = fi
+	}
+
+	for _, entry := range d.entries {
+		p := path.Join(rel, entry.Name)
+		fi, ok := real[entry.Name]
+		if !ok {
+			v.report(p, "missing", "")
+			continue
+		}
+
+		v.Checked++
+		v.verifyEntry(d, entry, fi, filepath.Join(dir, entry.Name), p)
+	}
+
+	for _, fi := range list {
+		if _, ok := d.Lookup(fi.Name()); !ok {
+			v.report(path.Join(rel, fi.Name()), "extra", "")
+		}
+	}
+}
+
+// verifyEntry compares the file fi at the real path filename with entry.
+func (v *Verifier) verifyEntry(d *Dir, entry DirEntry, fi os.FileInfo, filename, p string) {
+	var attr fuseops.InodeAttributes
+	if entry.Type == fuseutil.DT_Directory {
+		attr = d.Subdir(entry).Attributes()
+	} else {
+		attr = d.cfg.entryAttributes(entry)
+	}
+
+	if fi.Mode()&os.ModeType != attr.Mode&os.ModeType {
+		v.report(p, "type", "%v, want %v", fi.Mode()&os.ModeType, attr.Mode&os.ModeType)
+		return
+	}
+
+	if v.Metadata {
+		if fi.Mode()&PermBits != attr.Mode&PermBits {
+			v.report(p, "mode", "%v, want %v", fi.Mode()&PermBits, attr.Mode&PermBits)
+		}
+
+		// not all file systems store the modification time with the same
+		// precision
+		mtime, want := fi.ModTime().Truncate(time.Second), attr.Mtime.Truncate(time.Second)
+		if entry.Type != fuseutil.DT_Link && !mtime.Equal(want) {
+			v.report(p, "mtime", "%v, want %v", fi.ModTime(), attr.Mtime)
+		}
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && v.Owner {
+		if st.Uid != attr.Uid || st.Gid != attr.Gid {
+			v.report(p, "owner", "%d:%d, want %d:%d", st.Uid, st.Gid, attr.Uid, attr.Gid)
+		}
+	}
+
+	switch entry.Type {
+	case fuseutil.DT_Directory:
+		v.verifyDir(d.Subdir(entry), filename, p)
+	case fuseutil.DT_Link:
+		target, err := os.Readlink(filename)
+		if err != nil {
+			v.report(p, "error", "%v", err)
+			return
+		}
+
+		if target != entry.Target {
+			v.report(p, "target", "%q, want %q", target, entry.Target)
+		}
+	case fuseutil.DT_File:
+		if fi.Size() != int64(entry.Size) {
+			v.report(p, "size", "%d, want %d", fi.Size(), entry.Size)
+		}
+
+		if v.Content {
+			v.verifyContent(d.File(entry), filename, p)
+		}
+	}
+}
+
+// verifyContent compares the content of the real file filename with f and
+// reports the offset of the first difference.
+func (v *Verifier) verifyContent(f *File, filename, p string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		v.report(p, "error", "%v", err)
+		return
+	}
+	defer file.Close()
+
+	want := ContinuousFileReader(f, 0)
+	buf1 := make([]byte, verifyBufferSize)
+	buf2 := make([]byte, verifyBufferSize)
+
+	var pos int64
+	for {
+		n1, err1 := io.ReadFull(file, buf1)
+		n2, err2 := io.ReadFull(want, buf2)
+
+		n := n1
+		if n2 < n {
+			n = n2
+		}
+
+		if !bytes.Equal(buf1[:n], buf2[:n]) {
+			for i := 0; i < n; i++ {
+				if buf1[i] != buf2[i] {
+					v.report(p, "content", "differs at offset %d", pos+int64(i))
+					return
+				}
+			}
+		}
+
+		pos += int64(n)
+
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			v.report(p, "error", "%v", err1)
+			return
+		}
+
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			v.report(p, "error", "generating content failed: %v", err2)
+			return
+		}
+
+		// one of the files ended, the size has already been compared
+		if err1 != nil || err2 != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package fakedata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseutil"
+)
+
+// writeTestTree writes the files, directories and symlinks below d to dir.
+func writeTestTree(t testing.TB, d *Dir, dir string) {
+	for _, entry := range d.entries {
+		filename := filepath.Join(dir, entry.Name)
+		attr := d.cfg.entryAttributes(entry)
+
+		switch entry.Type {
+		case fuseutil.DT_Directory:
+			sub := d.Subdir(entry)
+			attr = sub.Attributes()
+			if err := os.Mkdir(filename, 0700); err != nil {
+				t.Fatal(err)
+			}
+			writeTestTree(t, sub, filename)
+		case fuseutil.DT_File:
+			buf, err := d.File(entry).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = ioutil.WriteFile(filename, buf, 0600); err != nil {
+				t.Fatal(err)
+			}
+		case fuseutil.DT_Link:
+			if err := os.Symlink(entry.Target, filename); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		default:
+			continue
+		}
+
+		if err := os.Chmod(filename, attr.Mode&os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(filename, attr.Atime, attr.Mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func verifyTestTree(t testing.TB, root *Dir, dir string) (diffs []Difference) {
+	v := Verifier{
+		Metadata: true,
+		Content:  true,
+		Report: func(d Difference) {
+			diffs = append(diffs, d)
+		},
+	}
+
+	err := v.Verify(root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return diffs
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakedatafs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Config{Seed: 23, MaxSize: 256 * 1024, FilesPerDir: 5, DirsPerDir: 2, Depth: 1, SymlinksPerDir: 2, Modes: []os.FileMode{0644}}
+	root := NewDir(&cfg, cfg.Seed, "/", cfg.Depth)
+	writeTestTree(t, root, dir)
+
+	if diffs := verifyTestTree(t, root, dir); len(diffs) != 0 {
+		t.Fatalf("unexpected differences %v", diffs)
+	}
+
+	var files []DirEntry
+	for _, entry := range root.entries {
+		if entry.Type == fuseutil.DT_File && entry.Size > 1000 {
+			files = append(files, entry)
+		}
+	}
+
+	if len(files) < 3 {
+		t.Fatalf("not enough files")
+	}
+
+	// corrupt the first file
+	filename := filepath.Join(dir, files[0].Name)
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf[1000] ^= 0xff
+	if err = ioutil.WriteFile(filename, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// truncate the second, remove the third, add an extra file and change
+	// the mode of a directory
+	if err = os.Truncate(filepath.Join(dir, files[1].Name), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Remove(filepath.Join(dir, files[2].Name)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "extra"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var subdir string
+	for _, entry := range root.entries {
+		if entry.Type == fuseutil.DT_Directory {
+			subdir = entry.Name
+		}
+	}
+
+	if err = os.Chmod(filepath.Join(dir, subdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range verifyTestTree(t, root, dir) {
+		got = append(got, d.String())
+	}
+
+	want := []string{
+		"content  /" + files[0].Name + ": differs at offset 1000",
+		"size     /" + files[1].Name + ": 10, want",
+		"missing  /" + files[2].Name,
+		"extra    /extra",
+		"mode     /" + subdir + ": -rwx------, want -r-xr-xr-x",
+	}
+
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if strings.HasPrefix(g, w) {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("difference %q not reported, got %q", w, got)
+		}
+	}
+}
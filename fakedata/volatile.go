@@ -0,0 +1,44 @@
+package fakedata
+
+import (
+	"math/rand"
+	"time"
+)
+
+// volatileKinds are the changes made to volatile files. ChangeTouch only
+// updates the modification time.
+var volatileKinds = []ChangeKind{ChangeModify, ChangeAppend, ChangeTruncate, ChangeTouch}
+
+// VolatileChange returns the change for the file described by entry if it is
+// one of the VolatileRate volatile files.
+func (cfg *Config) VolatileChange(entry DirEntry) (Change, bool) {
+	if cfg.VolatileRate <= 0 {
+		return Change{}, false
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(entry.Seed, "volatile")))
+	if rnd.Float64() >= cfg.VolatileRate {
+		return Change{}, false
+	}
+
+	c := Change{
+		Generation: cfg.Generation + 1,
+		Kind:       volatileKinds[rnd.Intn(len(volatileKinds))],
+		Seed:       rnd.Int63(),
+	}
+
+	switch c.Kind {
+	case ChangeAppend:
+		c.Size = 1 + rnd.Intn(cfg.MaxSize/2+1)
+	case ChangeTruncate:
+		c.Size = rnd.Intn(entry.Size + 1)
+	}
+
+	return c, true
+}
+
+// ChangeTime returns the time at which the change c to a volatile file is
+// made, a random time during the generation after the last one.
+func (cfg *Config) ChangeTime(c Change) time.Time {
+	return cfg.generationTime(c.Generation).Add(time.Duration(uint64(c.Seed) % uint64(generationInterval)))
+}
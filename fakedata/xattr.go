@@ -0,0 +1,104 @@
+package fakedata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// Xattr is an extended attribute.
+type Xattr struct {
+	Name  string
+	Value []byte
+}
+
+func (x Xattr) String() string {
+	return fmt.Sprintf("<Xattr %v, len %d>", x.Name, len(x.Value))
+}
+
+// These constants describe the format of the POSIX ACL extended attribute as
+// used by the Linux kernel (see include/uapi/linux/posix_acl_xattr.h).
+const (
+	aclVersion  = 2
+	aclUserObj  = 0x01
+	aclUser     = 0x02
+	aclGroupObj = 0x04
+	aclGroup    = 0x08
+	aclMask     = 0x10
+	aclOther    = 0x20
+)
+
+// vfsCapRevision2 is the magic number for security.capability values (see
+// include/uapi/linux/capability.h).
+const vfsCapRevision2 = 0x02000000
+
+// xattrs returns the extended attributes for the item with seed. Each item
+// gets XattrsPerFile user.* attributes with values of up to XattrMaxSize
+// bytes, and a fraction CapabilityRate and ACLRate of all items get a
+// security.capability or system.posix_acl_access attribute.
+func (cfg *Config) xattrs(seed int64) (attrs []Xattr) {
+	if cfg.XattrsPerFile <= 0 && cfg.CapabilityRate <= 0 && cfg.ACLRate <= 0 {
+		return nil
+	}
+
+	rnd := rand.New(rand.NewSource(deriveSeed(seed, "xattr")))
+	for i := 0; i < cfg.XattrsPerFile; i++ {
+		value := make([]byte, rnd.Intn(cfg.XattrMaxSize+1))
+
+		// use text and binary values in turn
+		kind := ContentText
+		if i%2 == 1 {
+			kind = ContentRandom
+		}
+
+		_, _ = io.ReadFull(contentStream(cfg.format(), kind, rnd.Int63(), 0, 0), value)
+		attrs = append(attrs, Xattr{
+			Name:  fmt.Sprintf("user.fakedatafs.%d", i),
+			Value: value,
+		})
+	}
+
+	if rnd.Float64() < cfg.CapabilityRate {
+		value := make([]byte, 20)
+		binary.LittleEndian.PutUint32(value[0:], vfsCapRevision2|1) // effective
+		binary.LittleEndian.PutUint32(value[4:], rnd.Uint32())      // permitted
+		binary.LittleEndian.PutUint32(value[8:], rnd.Uint32())      // inheritable
+		attrs = append(attrs, Xattr{Name: "security.capability", Value: value})
+	}
+
+	if rnd.Float64() < cfg.ACLRate {
+		attrs = append(attrs, Xattr{Name: "system.posix_acl_access", Value: randomACL(rnd)})
+	}
+
+	return attrs
+}
+
+// randomACL returns an access ACL with entries for some users and groups.
+func randomACL(rnd *rand.Rand) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, aclVersion)
+
+	add := func(tag uint16, perm uint16, id uint32) {
+		var entry [8]byte
+		binary.LittleEndian.PutUint16(entry[0:], tag)
+		binary.LittleEndian.PutUint16(entry[2:], perm)
+		binary.LittleEndian.PutUint32(entry[4:], id)
+		buf = append(buf, entry[:]...)
+	}
+
+	const undefinedID = 0xffffffff
+
+	// entries need to be sorted by tag and id
+	add(aclUserObj, 6, undefinedID)
+	users := 1 + rnd.Intn(3)
+	for i := 0; i < users; i++ {
+		add(aclUser, uint16(rnd.Intn(8)), uint32(1000+i*10+rnd.Intn(10)))
+	}
+	add(aclGroupObj, 4, undefinedID)
+	add(aclGroup, uint16(rnd.Intn(8)), uint32(100+rnd.Intn(100)))
+	add(aclMask, 7, undefinedID)
+	add(aclOther, 4, undefinedID)
+
+	return buf
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+// These are the operations for which faults can be injected.
+const (
+	OpRead    = "read"
+	OpLookup  = "lookup"
+	OpReadDir = "readdir"
+	OpGetAttr = "getattr"
+	OpAll     = "*"
+)
+
+// faultErrors are the errors which can be injected.
+var faultErrors = map[string]syscall.Errno{
+	"EIO":    syscall.EIO,
+	"EACCES": syscall.EACCES,
+	"ENOENT": syscall.ENOENT,
+	"EPERM":  syscall.EPERM,
+	"EAGAIN": syscall.EAGAIN,
+}
+
+// Fault describes a failure which is injected into operations on matching
+// paths. If Path does not contain a slash, it is matched against the last
+// element of the path only.
+type Fault struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+
+	// Error is the name of the error returned, e.g. EIO.
+	Error string `json:"error,omitempty"`
+
+	// ShortRead returns less data than requested for reads.
+	ShortRead bool `json:"short_read,omitempty"`
+
+	// Delay is added to the operation, e.g. "10ms".
+	Delay string `json:"delay,omitempty"`
+
+	// Rate is the fraction of matching operations which fail, zero means all
+	// of them. Which operations fail is derived from the seed, the path and
+	// for reads the offset, unless Random is set.
+	Rate   float64 `json:"rate,omitempty"`
+	Random bool    `json:"random,omitempty"`
+
+	errno syscall.Errno
+	delay time.Duration
+}
+
+func (f Fault) String() string {
+	return fmt.Sprintf("<Fault %v %v>", f.Op, f.Path)
+}
+
+// check validates the fault and parses the error and delay.
+func (f *Fault) check() error {
+	switch f.Op {
+	case OpRead, OpLookup, OpReadDir, OpGetAttr, OpAll:
+	default:
+		return fmt.Errorf("unknown operation %q", f.Op)
+	}
+
+	if _, err := path.Match(f.Path, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", f.Path, err)
+	}
+
+	if f.Error != "" {
+		errno, ok := faultErrors[strings.ToUpper(f.Error)]
+		if !ok {
+			return fmt.Errorf("unknown error %q", f.Error)
+		}
+		f.errno = errno
+	}
+
+	if f.Delay != "" {
+		d, err := time.ParseDuration(f.Delay)
+		if err != nil {
+			return err
+		}
+		f.delay = d
+	}
+
+	if f.errno == 0 && f.delay == 0 && !f.ShortRead {
+		return fmt.Errorf("fault for %v %v does nothing", f.Op, f.Path)
+	}
+
+	return nil
+}
+
+// matches returns true if the fault applies to op on p.
+func (f Fault) matches(op, p string) bool {
+	if f.Op != OpAll && f.Op != op {
+		return false
+	}
+
+	name := p
+	if !strings.Contains(f.Path, "/") {
+		name = path.Base(p)
+	}
+
+	ok, _ := path.Match(f.Path, name)
+	return ok
+}
+
+// ParseFault parses a fault in the form op:pattern:action[:rate[:random]].
+// Action is the name of an error (e.g. EIO), "short" or "delay=DURATION".
+func ParseFault(s string) (Fault, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 3 || len(parts) > 5 {
+		return Fault{}, fmt.Errorf("invalid fault %q, want op:pattern:action[:rate[:random]]", s)
+	}
+
+	f := Fault{Op: parts[0], Path: parts[1]}
+	switch action := parts[2]; {
+	case action == "short":
+		f.ShortRead = true
+	case strings.HasPrefix(action, "delay="):
+		f.Delay = strings.TrimPrefix(action, "delay=")
+	default:
+		f.Error = action
+	}
+
+	if len(parts) > 3 {
+		rate, err := strconv.ParseFloat(parts[3], 64)
+		if err != nil {
+			return Fault{}, fmt.Errorf("invalid rate in fault %q: %v", s, err)
+		}
+		f.Rate = rate
+	}
+
+	if len(parts) > 4 {
+		if parts[4] != "random" {
+			return Fault{}, fmt.Errorf("invalid fault %q, last field must be \"random\"", s)
+		}
+		f.Random = true
+	}
+
+	return f, f.check()
+}
+
+// LoadFaults reads a list of faults in JSON format from filename.
+func LoadFaults(filename string) ([]Fault, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var faults []Fault
+	err = json.Unmarshal(buf, &faults)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+
+	for i := range faults {
+		err = faults[i].check()
+		if err != nil {
+			return nil, fmt.Errorf("%v: fault %d: %v", filename, i, err)
+		}
+	}
+
+	return faults, nil
+}
+
+// FaultFS injects faults into the operations of a FakeDataFS.
+type FaultFS struct {
+	*FakeDataFS
+
+	faults []Fault
+
+	m   sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewFaultFS returns a file system which injects faults into fs.
+func NewFaultFS(fs *FakeDataFS, faults []Fault) *FaultFS {
+	return &FaultFS{
+		FakeDataFS: fs,
+		faults:     faults,
+		rnd:        rand.New(rand.NewSource(fs.Seed)),
+	}
+}
+
+// hit decides whether the fault with index i applies to this call.
+func (f *FaultFS) hit(i int, fault Fault, op, p string, off int64) (bool, float64) {
+	var v float64
+	if fault.Random {
+		f.m.Lock()
+		v = f.rnd.Float64()
+		f.m.Unlock()
+	} else {
+		key := fmt.Sprintf("%016x/%d/%s/%s/%d", uint64(f.Seed), i, op, p, off)
+		v = float64(uint64(fakedata.SeedForPath(0, "fault", key))>>11) / (1 << 53)
+	}
+
+	return fault.Rate <= 0 || v < fault.Rate, v
+}
+
+// inject applies all matching faults for op on the item at p. It returns the
+// fraction of data to return for short reads, which is 1 if no short read was
+// injected, and the error to return.
+func (f *FaultFS) inject(ctx context.Context, op, p string, off int64) (float64, error) {
+	short := 1.0
+	for i, fault := range f.faults {
+		if !fault.matches(op, p) {
+			continue
+		}
+
+		hit, v := f.hit(i, fault, op, p, off)
+		if !hit {
+			continue
+		}
+
+		V("inject fault %v for %v %v\n", fault, op, p)
+
+		if fault.delay > 0 {
+			select {
+			case <-time.After(fault.delay):
+			case <-ctx.Done():
+				return 1, ctx.Err()
+			}
+		}
+
+		if fault.errno != 0 {
+			return 1, fault.errno
+		}
+
+		if fault.ShortRead && op == OpRead {
+			short = v
+		}
+	}
+
+	return short, nil
+}
+
+// path returns the path for inode.
+func (f *FaultFS) path(inode fuseops.InodeID) string {
+	entry, ok := f.entry(inode)
+	if !ok {
+		return ""
+	}
+
+	return entry.Path
+}
+
+// GetInodeAttributes returns information about an inode.
+func (f *FaultFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	if _, err := f.inject(ctx, OpGetAttr, f.path(op.Inode), 0); err != nil {
+		return err
+	}
+
+	return f.FakeDataFS.GetInodeAttributes(ctx, op)
+}
+
+// LookUpInode returns information on an inode.
+func (f *FaultFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	if _, err := f.inject(ctx, OpLookup, path.Join(f.path(op.Parent), op.Name), 0); err != nil {
+		return err
+	}
+
+	return f.FakeDataFS.LookUpInode(ctx, op)
+}
+
+// ReadDir lists a directory.
+func (f *FaultFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
+	if _, err := f.inject(ctx, OpReadDir, f.path(op.Inode), int64(op.Offset)); err != nil {
+		return err
+	}
+
+	return f.FakeDataFS.ReadDir(ctx, op)
+}
+
+// ReadFile reads data from a file.
+func (f *FaultFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	short, err := f.inject(ctx, OpRead, f.path(op.Inode), op.Offset)
+	if err != nil {
+		return err
+	}
+
+	err = f.FakeDataFS.ReadFile(ctx, op)
+	if err != nil {
+		return err
+	}
+
+	// at least one byte is returned, an empty read would be taken for the
+	// end of the file
+	if short < 1 && op.BytesRead > 1 {
+		n := int(float64(op.BytesRead) * short)
+		if n < 1 {
+			n = 1
+		}
+		op.BytesRead = n
+	}
+
+	return nil
+}
+
+// OpenFile opens a file. Files with short read faults are opened with direct
+// I/O, otherwise the kernel takes a short read for the end of the file and
+// the data after it would be missing.
+func (f *FaultFS) OpenFile(ctx context.Context, op *fuseops.OpenFileOp) error {
+	err := f.FakeDataFS.OpenFile(ctx, op)
+	if err != nil {
+		return err
+	}
+
+	p := f.path(op.Inode)
+	for _, fault := range f.faults {
+		if fault.ShortRead && fault.matches(OpRead, p) {
+			op.UseDirectIO = true
+		}
+	}
+
+	return nil
+}
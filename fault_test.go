@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+func newTestFaultFS(t testing.TB, ctx context.Context, faults ...string) *FaultFS {
+	fs, err := NewFakeDataFS(ctx, fakedata.Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list []Fault
+	for _, s := range faults {
+		f, err := ParseFault(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, f)
+	}
+
+	return NewFaultFS(fs, list)
+}
+
+func TestFaultLookup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := newTestFaultFS(t, ctx, "lookup:file-1*:EACCES")
+
+	failed := 0
+	for _, entry := range fs.Root().Entries() {
+		op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: entry.Name}
+		err := fs.LookUpInode(ctx, op)
+		if entry.Name[:6] == "file-1" {
+			failed++
+			if err != syscall.EACCES {
+				t.Errorf("%v: want EACCES, got %v", entry.Name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", entry.Name, err)
+		}
+	}
+
+	if failed == 0 {
+		t.Fatal("no matching file found")
+	}
+}
+
+func TestFaultRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := newTestFaultFS(t, ctx, "getattr:*:EIO:0.3")
+
+	results := make(map[string]error)
+	for _, entry := range fs.Root().Entries() {
+		op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: entry.Name}
+		err := fs.LookUpInode(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results[entry.Name] = fs.GetInodeAttributes(ctx, &fuseops.GetInodeAttributesOp{Inode: op.Entry.Child})
+	}
+
+	failed := 0
+	for _, err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed < 15 || failed > 45 {
+		t.Errorf("unexpected number of failures: %d", failed)
+	}
+
+	// the same files fail again
+	for _, entry := range fs.Root().Entries() {
+		err := fs.GetInodeAttributes(ctx, &fuseops.GetInodeAttributesOp{Inode: entry.Inode})
+		if err != results[entry.Name] {
+			t.Errorf("%v: fault is not deterministic: %v != %v", entry.Name, err, results[entry.Name])
+		}
+	}
+}
+
+func TestFaultShortReadAndDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := newTestFaultFS(t, ctx, "read:*:short", "read:*:delay=20ms")
+
+	var entry fakedata.DirEntry
+	for _, entry = range fs.Root().Entries() {
+		if entry.Size > 64*1024 {
+			break
+		}
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: entry.Name}
+	err := fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	op := &fuseops.ReadFileOp{Inode: lookup.Entry.Child, Dst: make([]byte, 64*1024)}
+	err = fs.ReadFile(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("read was not delayed")
+	}
+
+	if op.BytesRead >= len(op.Dst) {
+		t.Errorf("want short read, got %d bytes", op.BytesRead)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	f, err := ParseFault("read:/dir-*/file-*:EIO:0.5:random")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Op != OpRead || f.errno != syscall.EIO || f.Rate != 0.5 || !f.Random {
+		t.Errorf("wrong fault parsed: %+v", f)
+	}
+
+	if !f.matches(OpRead, "/dir-1/file-2") || f.matches(OpRead, "/dir-1/sub/file-2") || f.matches(OpLookup, "/dir-1/file-2") {
+		t.Errorf("wrong paths matched")
+	}
+
+	for _, s := range []string{"read:*", "write:*:EIO", "read:*:EFOO", "read:*:delay=foo", "read:*:EIO:x", "read:[:EIO"} {
+		_, err = ParseFault(s)
+		if err == nil {
+			t.Errorf("expected error for %q not found", s)
+		}
+	}
+}
+
+func TestLoadFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakedatafs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "faults.json")
+	data := `[{"op": "read", "path": "*", "error": "EIO", "rate": 0.1}, {"op": "*", "path": "/dir-*", "delay": "1ms"}]`
+	err = ioutil.WriteFile(filename, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	faults, err := LoadFaults(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(faults) != 2 || faults[0].errno != syscall.EIO || faults[1].delay != time.Millisecond {
+		t.Errorf("wrong faults loaded: %+v", faults)
+	}
+}
+
+func TestFaultShortReadDirectIO(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := newTestFaultFS(t, ctx, "read:*:short:0.5")
+
+	var entry fakedata.DirEntry
+	for _, entry = range fs.Root().Entries() {
+		if entry.Size > 256*1024 {
+			break
+		}
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: entry.Name}
+	err := fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode := lookup.Entry.Child
+
+	open := &fuseops.OpenFileOp{Inode: inode}
+	err = fs.OpenFile(ctx, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without direct I/O, the kernel would stop at the first short read
+	if !open.UseDirectIO {
+		t.Fatal("file with short reads not opened with direct I/O")
+	}
+
+	// read like the kernel does with direct I/O: continue after short reads
+	// until an empty read signals the end of the file
+	var buf []byte
+	short := 0
+	for {
+		op := &fuseops.ReadFileOp{Inode: inode, Offset: int64(len(buf)), Dst: make([]byte, 16*1024)}
+		err = fs.ReadFile(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if op.BytesRead == 0 {
+			break
+		}
+
+		if op.BytesRead < len(op.Dst) && len(buf)+op.BytesRead < entry.Size {
+			short++
+		}
+		buf = append(buf, op.Dst[:op.BytesRead]...)
+	}
+
+	if short == 0 {
+		t.Errorf("no short reads injected")
+	}
+
+	want, err := fs.Root().File(entry).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != string(want) {
+		t.Errorf("wrong content after short reads, got %d bytes, want %d", len(buf), len(want))
+	}
+
+	// other files are opened with the page cache
+	fs = newTestFaultFS(t, ctx, "read:does-not-exist:short")
+	err = fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open = &fuseops.OpenFileOp{Inode: lookup.Entry.Child}
+	err = fs.OpenFile(ctx, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if open.UseDirectIO {
+		t.Errorf("file without short reads opened with direct I/O")
+	}
+}
@@ -3,86 +3,117 @@ package main
 import (
 	"io"
 	"os"
-	"time"
+	"path"
+	"sync"
 
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/restic/fakedatafs/fakedata"
 	"golang.org/x/net/context"
 )
 
 // Entry is an entry for a file or dir in the file system.
 type Entry struct {
 	Attr fuseops.InodeAttributes
-	Dir  *Dir
-	File *File
+	Dir  *fakedata.Dir
+	File *fakedata.File
+
+	// Path is the path of the entry within the file system.
+	Path string
+
+	// Target is the target of a symlink.
+	Target string
+
+	Xattrs []fakedata.Xattr
+
+	// changed is true if the change for a volatile file has been applied.
+	changed bool
+
+	// lookups is the number of times the kernel has looked up this entry
+	// without forgetting it again.
+	lookups uint64
 }
 
-// FakeDataFS is a filesystem filled with fake data.
+// FakeDataFS is a filesystem filled with fake data. Entries are generated when
+// the kernel looks them up and are removed again when the kernel forgets
+// them, so the memory usage does not depend on the size of the tree.
 type FakeDataFS struct {
-	Seed        int64
-	MaxSize     int
-	FilesPerDir int
+	fakedata.Config
 
-	entries map[fuseops.InodeID]Entry
-	cache   *Cache
+	// ReadWorkers is the number of goroutines generating the content of
+	// sequential reads, see fakedata.FileReader.
+	ReadWorkers int
+
+	m        sync.Mutex
+	entries  map[fuseops.InodeID]*Entry
+	volatile map[fuseops.InodeID]*volatileState
+	cache    *Cache
 
 	fuseutil.NotImplementedFileSystem
 }
 
 // NewFakeDataFS creates a new filesystem.
-func NewFakeDataFS(ctx context.Context, seed int64, maxSize int, filesPerDir int) (fs *FakeDataFS, err error) {
+func NewFakeDataFS(ctx context.Context, cfg fakedata.Config) (fs *FakeDataFS, err error) {
 	fs = &FakeDataFS{
-		Seed:        seed,
-		MaxSize:     maxSize,
-		FilesPerDir: filesPerDir,
-		cache:       newCache(ctx),
-		entries:     make(map[fuseops.InodeID]Entry),
+		Config:   cfg,
+		cache:    newCache(ctx),
+		entries:  make(map[fuseops.InodeID]*Entry),
+		volatile: make(map[fuseops.InodeID]*volatileState),
 	}
-	V("create filesystem with seed %v, max size %v, %v files per dir\n", seed, maxSize, filesPerDir)
-
-	d, err := NewDir(fs, seed, "/", filesPerDir, maxSize), nil
-	if err != nil {
-		return nil, err
+	V("create filesystem with seed %v, max size %v, %v files and %v dirs per dir, depth %v, generation %v\n",
+		cfg.Seed, cfg.MaxSize, cfg.FilesPerDir, cfg.DirsPerDir, cfg.Depth, cfg.Generation)
+
+	root := fs.Root()
+	fs.entries[fuseops.RootInodeID] = &Entry{
+		Dir:    root,
+		Path:   "/",
+		Attr:   root.Attributes(),
+		Xattrs: root.Xattrs(),
 	}
 
-	fs.entries[fuseops.RootInodeID] = Entry{
-		Dir: d,
-		Attr: fuseops.InodeAttributes{
-			Atime:  time.Now(),
-			Ctime:  time.Now(),
-			Mtime:  time.Now(),
-			Crtime: time.Now(),
+	return fs, nil
+}
 
-			Uid: uint32(os.Getuid()),
-			Gid: uint32(os.Getgid()),
+// Root generates the root directory.
+func (f *FakeDataFS) Root() *fakedata.Dir {
+	return fakedata.NewDir(&f.Config, f.Seed, "/", f.Depth)
+}
 
-			Mode: os.ModeDir | 0555,
-		},
-	}
+// entry returns the entry for inode, if it is currently known.
+func (f *FakeDataFS) entry(inode fuseops.InodeID) (*Entry, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
 
-	return fs, nil
+	entry, ok := f.entries[inode]
+	return entry, ok
 }
 
-var rootAttributes = fuseops.InodeAttributes{
-	Atime:  time.Now(),
-	Ctime:  time.Now(),
-	Mtime:  time.Now(),
-	Crtime: time.Now(),
+// snapshot returns a copy of the entry for inode, if it is currently known.
+func (f *FakeDataFS) snapshot(inode fuseops.InodeID) (Entry, bool) {
+	f.m.Lock()
+	defer f.m.Unlock()
 
-	Uid: uint32(os.Getuid()),
-	Gid: uint32(os.Getgid()),
+	entry, ok := f.entries[inode]
+	if !ok {
+		return Entry{}, false
+	}
 
-	Mode: os.ModeDir | 0555,
+	f.checkVolatile(inode, entry)
+	return *entry, true
 }
 
 // GetInodeAttributes returns information about an inode.
 func (f *FakeDataFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
 	entry, ok := f.entries[op.Inode]
 	if !ok {
 		return fuse.ENOENT
 	}
 
+	f.checkVolatile(op.Inode, entry)
 	op.Attributes = entry.Attr
 	return nil
 }
@@ -97,14 +128,36 @@ func (f *FakeDataFS) ReleaseDirHandle(context.Context, *fuseops.ReleaseDirHandle
 	return nil
 }
 
-// ForgetInode frees an inode.
-func (f *FakeDataFS) ForgetInode(context.Context, *fuseops.ForgetInodeOp) error {
+// ForgetInode decrements the lookup count of an inode and removes it once the
+// kernel does not reference it any more.
+func (f *FakeDataFS) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	if op.Inode == fuseops.RootInodeID {
+		return nil
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	entry, ok := f.entries[op.Inode]
+	if !ok {
+		return nil
+	}
+
+	if op.N < entry.lookups {
+		entry.lookups -= op.N
+		return nil
+	}
+
+	V("forget inode %v\n", op.Inode)
+	delete(f.entries, op.Inode)
+	f.forgetVolatile(op.Inode)
+	f.cache.Drop(op.Inode)
 	return nil
 }
 
 // ReadDir lists a directory.
 func (f *FakeDataFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
-	entry, ok := f.entries[op.Inode]
+	entry, ok := f.entry(op.Inode)
 	if !ok {
 		return fuse.ENOENT
 	}
@@ -113,7 +166,7 @@ func (f *FakeDataFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
 		return fuse.EIO
 	}
 
-	if int(op.Offset) > len(entry.Dir.entries) {
+	if int(op.Offset) > len(entry.Dir.Entries()) {
 		return fuse.EIO
 	}
 
@@ -136,56 +189,151 @@ func (f *FakeDataFS) OpenFile(
 	return
 }
 
-// LookUpInode returns information on an inode.
+// LookUpInode returns information on an inode. The entry is generated if the
+// kernel does not know about it yet.
 func (f *FakeDataFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
-	entry, ok := f.entries[op.Parent]
+	parent, ok := f.entry(op.Parent)
 	if !ok {
 		return fuse.ENOENT
 	}
 
-	if entry.Dir == nil {
+	if parent.Dir == nil {
 		return fuse.EIO
 	}
 
-	d := entry.Dir
+	return f.lookUp(parent.Dir, op.Name, &op.Entry)
+}
+
+// lookUp returns information on the entry name in d in child. The entry is
+// generated if the kernel does not know about it yet.
+func (f *FakeDataFS) lookUp(d *fakedata.Dir, name string, child *fuseops.ChildInodeEntry) error {
+	dirent, ok := d.Lookup(name)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	f.m.Lock()
+	entry, ok := f.entries[dirent.Inode]
+	if ok {
+		entry.lookups++
+		f.checkVolatile(dirent.Inode, entry)
 
-	for _, entry := range d.entries {
-		if op.Name == entry.Name {
-			fsEntry, ok := f.entries[entry.Inode]
-			if !ok {
-				return fuse.EIO
-			}
+		child.Child = dirent.Inode
+		child.Attributes = entry.Attr
+		f.m.Unlock()
+		return nil
+	}
+	f.m.Unlock()
+
+	// generate the new entry without holding the lock
+	entry = &Entry{lookups: 1, Path: path.Join(d.Path(), dirent.Name), Xattrs: d.EntryXattrs(dirent)}
+	switch dirent.Type {
+	case fuseutil.DT_Directory:
+		entry.Dir = d.Subdir(dirent)
+		entry.Attr = entry.Dir.Attributes()
+	case fuseutil.DT_File:
+		entry.File = d.File(dirent)
+		entry.Attr = d.EntryAttributes(dirent)
+	default:
+		entry.Target = dirent.Target
+		entry.Attr = d.EntryAttributes(dirent)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
 
-			op.Entry.Child = entry.Inode
-			op.Entry.Attributes = fsEntry.Attr
+	if existing, ok := f.entries[dirent.Inode]; ok {
+		// somebody else was faster
+		existing.lookups++
+		entry = existing
+	} else {
+		f.entries[dirent.Inode] = entry
+		if dirent.Type == fuseutil.DT_File {
+			f.registerVolatile(dirent)
 		}
 	}
 
+	f.checkVolatile(dirent.Inode, entry)
+
+	child.Child = dirent.Inode
+	child.Attributes = entry.Attr
 	return nil
 }
 
+// ReadSymlink returns the target of a symlink.
+func (f *FakeDataFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) error {
+	entry, ok := f.entry(op.Inode)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	if entry.Attr.Mode&os.ModeSymlink == 0 {
+		return fuse.EINVAL
+	}
+
+	op.Target = entry.Target
+	return nil
+}
+
+// GetXattr returns the value of an extended attribute.
+func (f *FakeDataFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) (err error) {
+	entry, ok := f.entry(op.Inode)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	op.BytesRead, err = getXattr(entry.Xattrs, op.Name, op.Dst)
+	return err
+}
+
+// ListXattr lists the names of all extended attributes.
+func (f *FakeDataFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) (err error) {
+	entry, ok := f.entry(op.Inode)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	op.BytesRead, err = listXattr(entry.Xattrs, op.Dst)
+	return err
+}
+
 // ReadFile reads data from a file.
 func (f *FakeDataFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
+	f.m.Lock()
 	entry, ok := f.entries[op.Inode]
 	if !ok {
+		f.m.Unlock()
 		return fuse.ENOENT
 	}
 
-	if entry.File == nil {
+	f.checkVolatile(op.Inode, entry)
+	f.countRead(op.Inode)
+	file := entry.File
+	f.m.Unlock()
+
+	if file == nil {
 		return fuse.EIO
 	}
 
 	rd, err := f.cache.Get(op.Inode, op.Offset)
 	if err != nil {
-		rd = ContinuousFileReader(entry.File, op.Offset)
+		fr := fakedata.NewFileReader(file)
+		fr.Workers = f.ReadWorkers
+		_, err = fr.Seek(op.Offset, io.SeekStart)
+		if err != nil {
+			return fuse.EINVAL
+		}
+		rd = fr
 	}
 
 	n, err := io.ReadFull(rd, op.Dst)
-	if err == io.ErrUnexpectedEOF {
-		err = nil
-	} else {
+	switch err {
+	case nil:
 		f.cache.Put(op.Inode, op.Offset+int64(n), rd)
+	case io.ErrUnexpectedEOF, io.EOF:
+		// end of file reached
+		err = nil
 	}
-	op.BytesRead = len(op.Dst)
+	op.BytesRead = n
 	return err
 }
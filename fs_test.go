@@ -1,4 +1,206 @@
 package main
 
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
 // ensure that FakeDataFS implements fuse/fs.FS
 // var _ fs.FS = FakeDataFS{}
+
+func TestNestedDirs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs, err := NewFakeDataFS(ctx, fakedata.Config{Seed: 23, MaxSize: 1024, FilesPerDir: 5, DirsPerDir: 3, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walk func(inode fuseops.InodeID, dir string, level int) int
+	walk = func(inode fuseops.InodeID, dir string, level int) (dirs int) {
+		entry, ok := fs.entry(inode)
+		if !ok || entry.Dir == nil {
+			t.Fatalf("%v: not a dir", dir)
+		}
+
+		op := &fuseops.ReadDirOp{Inode: inode, Dst: make([]byte, 64*1024)}
+		err := fs.ReadDir(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if op.BytesRead == 0 {
+			t.Fatalf("%v: no entries returned", dir)
+		}
+
+		files, subdirs := 0, 0
+		for _, dirent := range entry.Dir.Entries() {
+			lookup := &fuseops.LookUpInodeOp{Parent: inode, Name: dirent.Name}
+			err = fs.LookUpInode(ctx, lookup)
+			if err != nil {
+				t.Fatalf("lookup %v in %v failed: %v", dirent.Name, dir, err)
+			}
+
+			if lookup.Entry.Child != dirent.Inode {
+				t.Errorf("wrong inode for %v in %v", dirent.Name, dir)
+			}
+
+			switch dirent.Type {
+			case fuseutil.DT_File:
+				files++
+			case fuseutil.DT_Directory:
+				subdirs++
+				if lookup.Entry.Attributes.Mode&os.ModeDir == 0 {
+					t.Errorf("%v in %v is not a dir", dirent.Name, dir)
+				}
+				dirs += walk(lookup.Entry.Child, path.Join(dir, dirent.Name), level+1)
+			}
+		}
+
+		if files != 5 {
+			t.Errorf("%v: want 5 files, got %d", dir, files)
+		}
+
+		wantDirs := 3
+		if level == 2 {
+			wantDirs = 0
+		}
+
+		if subdirs != wantDirs {
+			t.Errorf("%v: want %d dirs, got %d", dir, wantDirs, subdirs)
+		}
+
+		return dirs + subdirs
+	}
+
+	dirs := walk(fuseops.RootInodeID, "/", 0)
+	if dirs != 3+3*3 {
+		t.Errorf("want %d dirs in total, got %d", 3+3*3, dirs)
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "does-not-exist"}
+	err = fs.LookUpInode(ctx, lookup)
+	if err != fuse.ENOENT {
+		t.Errorf("lookup of missing file returned wrong error %v", err)
+	}
+}
+
+func TestForgetInode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs, err := NewFakeDataFS(ctx, fakedata.Config{Seed: 23, MaxSize: 1024, FilesPerDir: 5, DirsPerDir: 3, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := fs.Root().Entries()[0].Name
+	var inode fuseops.InodeID
+	for i := 0; i < 2; i++ {
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: name}
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inode = lookup.Entry.Child
+	}
+
+	entry, ok := fs.entry(inode)
+	if !ok {
+		t.Fatalf("entry for %v not found after lookup", name)
+	}
+	content, err := entry.File.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fs.entries) != 2 {
+		t.Errorf("want 2 entries, got %d", len(fs.entries))
+	}
+
+	err = fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok = fs.entry(inode); !ok {
+		t.Fatalf("entry removed while still referenced")
+	}
+
+	err = fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok = fs.entry(inode); ok {
+		t.Fatalf("entry not removed")
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: name}
+	err = fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, _ = fs.entry(inode)
+	content2, err := entry.File.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(content, content2) {
+		t.Errorf("regenerated file has different content")
+	}
+}
+
+func TestReadFileWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 8 << 20, Sizes: fakedata.Fixed{Value: 8<<20 + 123}, FilesPerDir: 1}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.ReadWorkers = 4
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: fs.Root().Entries()[0].Name}
+	err = fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, _ := fs.entry(lookup.Entry.Child)
+	want, err := entry.File.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sequential reads as issued by the kernel
+	var buf []byte
+	for {
+		op := &fuseops.ReadFileOp{Inode: lookup.Entry.Child, Offset: int64(len(buf)), Dst: make([]byte, 128<<10)}
+		err = fs.ReadFile(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if op.BytesRead == 0 {
+			break
+		}
+		buf = append(buf, op.Dst[:op.BytesRead]...)
+	}
+
+	if !reflect.DeepEqual(buf, want) {
+		t.Errorf("wrong content read with %d workers", fs.ReadWorkers)
+	}
+}
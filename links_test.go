@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+func TestLinks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 1024, FilesPerDir: 10, SymlinksPerDir: 8, HardlinksPerDir: 3, SpecialPerDir: 4}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := fs.entry(fuseops.RootInodeID)
+	kinds := make(map[fakedata.SymlinkKind]int)
+	modes := make(map[os.FileMode]int)
+	hardlinks := 0
+
+	for _, dirent := range root.Dir.Entries() {
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: dirent.Name}
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attr := lookup.Entry.Attributes
+
+		switch dirent.Type {
+		case fuseutil.DT_Link:
+			op := &fuseops.ReadSymlinkOp{Inode: lookup.Entry.Child}
+			err = fs.ReadSymlink(ctx, op)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if attr.Mode&os.ModeSymlink == 0 || attr.Size != uint64(len(op.Target)) {
+				t.Errorf("%v: wrong attributes for symlink: %v", dirent.Name, attr.DebugString())
+			}
+
+			_, exists := root.Dir.Lookup(op.Target)
+			switch {
+			case op.Target == dirent.Name:
+				kinds[fakedata.SymlinkLoop]++
+			case path.IsAbs(op.Target):
+				_, exists = root.Dir.Lookup(path.Base(op.Target))
+				if !exists {
+					t.Errorf("%v: target %v does not exist", dirent.Name, op.Target)
+				}
+				kinds[fakedata.SymlinkAbsolute]++
+			case exists:
+				kinds[fakedata.SymlinkRelative]++
+			default:
+				kinds[fakedata.SymlinkDangling]++
+			}
+		case fuseutil.DT_File:
+			if attr.Nlink > 1 {
+				hardlinks++
+				if lookup.Entry.Child != dirent.Inode {
+					t.Errorf("%v: hardlink has wrong inode", dirent.Name)
+				}
+			}
+		case fuseutil.DT_Directory:
+			t.Errorf("unexpected dir %v", dirent.Name)
+		default:
+			modes[attr.Mode&os.ModeType]++
+		}
+	}
+
+	symlinkKinds := []fakedata.SymlinkKind{fakedata.SymlinkRelative, fakedata.SymlinkAbsolute, fakedata.SymlinkDangling, fakedata.SymlinkLoop}
+	for _, kind := range symlinkKinds {
+		if kinds[kind] != 2 {
+			t.Errorf("want 2 symlinks of kind %d, got %d", kind, kinds[kind])
+		}
+	}
+
+	// FIFOs, character and block devices and sockets
+	if len(modes) != 4 {
+		t.Errorf("want 4 different special files, got %v", modes)
+	}
+
+	if hardlinks < 4 {
+		t.Errorf("want at least 4 names for files with hardlinks, got %d", hardlinks)
+	}
+
+	// regular files are not symlinks
+	entry, _ := root.Dir.Lookup(root.Dir.Entries()[0].Name)
+	err = fs.ReadSymlink(ctx, &fuseops.ReadSymlinkOp{Inode: entry.Inode})
+	if err == nil {
+		t.Errorf("ReadSymlink for regular file succeeded")
+	}
+}
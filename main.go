@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -8,12 +9,14 @@ import (
 	"runtime"
 	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseutil"
 	"github.com/jessevdk/go-flags"
+	"github.com/restic/fakedatafs/fakedata"
 )
 
 var (
@@ -25,10 +28,66 @@ type Options struct {
 	Version bool `long:"version" short:"V"     description:"print version number"`
 	Verbose bool `long:"verbose" short:"v"     description:"be verbose"`
 	Debug   bool `long:"debug"                 description:"output debug messages"`
+	Stats   bool `long:"stats"                 description:"print statistics about the tree, including the expected fraction of duplicate data, and exit"`
+
+	Spec string `long:"spec" description:"load the description of the tree in JSON format from this file, settings in the file override the options"`
+
+	FormatVersion int `long:"format-version" default:"0" description:"version of the format of the generated data, a seed generates the same data in all releases for the same version (0 selects the latest)"`
+
+	ReadWorkers int `long:"read-workers" default:"0" description:"number of goroutines generating the content of large and sequential reads (0 for the number of CPUs)"`
 
 	Seed     int64 `long:"seed"                    default:"23" description:"initial random seed"`
 	NumFiles int   `long:"files-per-dir" short:"n" default:"100" description:"number of files per directory"`
 	MaxSize  int   `long:"maxsize"       short:"m" default:"100" description:"max individual file size, in KiB"`
+	MinSize  int   `long:"minsize"                 default:"0"   description:"min individual file size, in KiB"`
+	NumDirs  int   `long:"dirs-per-dir"            default:"10"  description:"number of subdirectories per directory"`
+	Depth    int   `long:"depth"         short:"d" default:"0"   description:"number of nested directory levels below the root"`
+
+	NumSymlinks  int `long:"symlinks-per-dir"  default:"0" description:"number of symlinks per directory (relative, absolute, dangling and looping)"`
+	NumHardlinks int `long:"hardlinks-per-dir" default:"0" description:"number of additional hardlinks to files per directory"`
+	NumSpecial   int `long:"special-per-dir"   default:"0" description:"number of special files (FIFOs, devices, sockets) per directory"`
+
+	SizeDistribution string  `long:"size-distribution" default:"uniform" choice:"uniform" choice:"lognormal" choice:"pareto" choice:"fixed" choice:"histogram" description:"distribution of file sizes: uniform, lognormal, pareto, fixed or histogram"`
+	SizeMedian       int     `long:"size-median"       default:"16"      description:"median file size for the lognormal distribution, in KiB"`
+	SizeSigma        float64 `long:"size-sigma"        default:"2"       description:"standard deviation of the log of the file size for the lognormal distribution"`
+	SizeAlpha        float64 `long:"size-alpha"        default:"1.2"     description:"shape parameter of the pareto distribution"`
+	SizeHistogram    string  `long:"size-histogram"                      description:"load the histogram for the histogram distribution from this file"`
+
+	Content         []string `long:"content"         default:"random" description:"content generator for files, one is selected per file if given multiple times: random, zero, pattern, text, compressible or mixed"`
+	Compressibility float64  `long:"compressibility" default:"0.5"    description:"fraction of null bytes in files with compressible content"`
+
+	DupRate      float64 `long:"dup-rate"      default:"0"   description:"fraction of segments which contain data shared with other segments"`
+	DupFileRate  float64 `long:"dup-file-rate" default:"0"   description:"fraction of files which are exact duplicates of other files"`
+	DupPoolSize  int     `long:"dup-pool-size" default:"100" description:"number of distinct seeds shared by duplicate segments and files"`
+	DupUnaligned float64 `long:"dup-unaligned" default:"0.5" description:"fraction of duplicate segments starting at an unaligned offset of the shared data"`
+
+	SparseRate float64 `long:"sparse-rate" default:"0"   description:"fraction of sparse files"`
+	HoleRate   float64 `long:"hole-rate"   default:"0.5" description:"fraction of holes in sparse files"`
+
+	Generation int     `long:"generation" short:"g" default:"0"   description:"number of generations of changes applied to the tree"`
+	ChangeRate float64 `long:"change-rate"          default:"0.1" description:"fraction of files changed per generation"`
+
+	VolatileRate  float64       `long:"volatile-rate"  default:"0" description:"fraction of files which change while they are read"`
+	VolatileReads int           `long:"volatile-reads" default:"1" description:"change volatile files after this number of reads (0 to disable)"`
+	VolatileDelay time.Duration `long:"volatile-delay" default:"0" description:"change volatile files this long after they were first accessed (0 to disable)"`
+
+	MtimeRange      string  `long:"mtime-range"                     description:"range for the modification times of files, e.g. 2010-01-01..2020-01-01"`
+	Uids            string  `long:"uids"                            description:"comma separated list of user IDs for files, e.g. 0,1000-1005 (default: current user)"`
+	Gids            string  `long:"gids"                            description:"comma separated list of group IDs for files (default: current group)"`
+	Modes           string  `long:"modes"             default:"644" description:"comma separated list of octal permissions for files"`
+	SpecialBitsRate float64 `long:"special-bits-rate" default:"0"   description:"fraction of files with the setuid, setgid or sticky bit set"`
+	UnreadableRate  float64 `long:"unreadable-rate"   default:"0"   description:"fraction of files without read permissions"`
+
+	XattrsPerFile  int     `long:"xattrs-per-file"  default:"0"   description:"number of user.* extended attributes per file and directory"`
+	XattrMaxSize   int     `long:"xattr-max-size"   default:"256" description:"max size of extended attribute values, in bytes"`
+	CapabilityRate float64 `long:"capability-rate"  default:"0"   description:"fraction of files with a security.capability attribute"`
+	ACLRate        float64 `long:"acl-rate"         default:"0"   description:"fraction of files and directories with an access ACL"`
+
+	Writable   bool   `long:"writable"    description:"record writes, new files, renames and removals in an overlay on top of the generated data"`
+	OverlayDir string `long:"overlay-dir" description:"store the data written to files in temporary files in this directory instead of memory (implies --writable)"`
+
+	Faults     []string `long:"fault"       description:"inject faults, op:pattern:action[:rate[:random]], e.g. read:file-1*:EIO:0.1 (op is read, lookup, readdir, getattr or *, action an error name, short or delay=DURATION)"`
+	FaultsFile string   `long:"faults-file" description:"load faults in JSON format from this file"`
 
 	mountpoint string
 }
@@ -40,11 +99,13 @@ var ctx context.Context
 
 func init() {
 	parser.Usage = "mountpoint"
+	parser.SubcommandsOptional = true
+	fakedata.Logf = V
 
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(context.Background())
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT)
 
 	go func() {
@@ -52,17 +113,18 @@ func init() {
 
 		for range c {
 			once.Do(func() {
-				fmt.Println("Interrupt received, cleaning up")
+				fmt.Fprintln(os.Stderr, "Interrupt received, cleaning up")
 				cancel()
 			})
 		}
 	}()
 }
 
-// V prints debug messages if verbose mode is requested.
+// V prints debug messages to stderr if verbose mode is requested, so they
+// are not mixed with data written to stdout.
 func V(format string, data ...interface{}) {
 	if opts.Verbose {
-		fmt.Printf(format, data...)
+		fmt.Fprintf(os.Stderr, format, data...)
 	}
 }
 
@@ -71,26 +133,224 @@ func M(format string, data ...interface{}) {
 	fmt.Printf(format, data...)
 }
 
+// sizeDistribution returns the size distribution selected in opts.
+func sizeDistribution(opts Options) (fakedata.SizeDistribution, error) {
+	min, max := opts.MinSize*1024, opts.MaxSize*1024
+	if min > max {
+		return nil, fmt.Errorf("minimal size %v KiB is larger than maximal size %v KiB", opts.MinSize, opts.MaxSize)
+	}
+
+	switch opts.SizeDistribution {
+	case "uniform":
+		return fakedata.Uniform{Min: min, Max: max}, nil
+	case "fixed":
+		return fakedata.Fixed{Value: max}, nil
+	case "lognormal":
+		return fakedata.LogNormal{Min: min, Max: max, Median: opts.SizeMedian * 1024, Sigma: opts.SizeSigma}, nil
+	case "pareto":
+		if opts.SizeAlpha <= 0 {
+			return nil, fmt.Errorf("invalid shape parameter %v for pareto distribution", opts.SizeAlpha)
+		}
+		return fakedata.Pareto{Min: min, Max: max, Alpha: opts.SizeAlpha}, nil
+	case "histogram":
+		if opts.SizeHistogram == "" {
+			return nil, errors.New("histogram distribution needs --size-histogram")
+		}
+		return fakedata.LoadHistogram(opts.SizeHistogram)
+	}
+
+	return nil, fmt.Errorf("unknown size distribution %q", opts.SizeDistribution)
+}
+
+// readWorkers returns the number of goroutines generating the content of
+// reads selected in opts.
+func readWorkers(opts Options) int {
+	if opts.ReadWorkers <= 0 {
+		return runtime.NumCPU()
+	}
+
+	return opts.ReadWorkers
+}
+
+// config returns the configuration of the tree described by opts.
+func config(opts Options) (fakedata.Config, error) {
+	sizes, err := sizeDistribution(opts)
+	if err != nil {
+		return fakedata.Config{}, err
+	}
+
+	var contents []fakedata.ContentKind
+	for _, name := range opts.Content {
+		kind, err := fakedata.ParseContentKind(name)
+		if err != nil {
+			return fakedata.Config{}, err
+		}
+		contents = append(contents, kind)
+	}
+
+	err = fakedata.CheckFormat(opts.FormatVersion)
+	if err != nil {
+		return fakedata.Config{}, err
+	}
+
+	cfg := fakedata.Config{
+		Seed:        opts.Seed,
+		MaxSize:     opts.MaxSize * 1024,
+		Sizes:       sizes,
+		FilesPerDir: opts.NumFiles,
+		DirsPerDir:  opts.NumDirs,
+		Depth:       opts.Depth,
+
+		FormatVersion: opts.FormatVersion,
+
+		SymlinksPerDir:  opts.NumSymlinks,
+		HardlinksPerDir: opts.NumHardlinks,
+		SpecialPerDir:   opts.NumSpecial,
+
+		Contents:        contents,
+		Compressibility: opts.Compressibility,
+
+		DupRate:      opts.DupRate,
+		DupFileRate:  opts.DupFileRate,
+		DupPoolSize:  opts.DupPoolSize,
+		DupUnaligned: opts.DupUnaligned,
+
+		SparseRate: opts.SparseRate,
+		HoleRate:   opts.HoleRate,
+
+		Generation: opts.Generation,
+		ChangeRate: opts.ChangeRate,
+
+		VolatileRate:  opts.VolatileRate,
+		VolatileReads: opts.VolatileReads,
+		VolatileDelay: opts.VolatileDelay,
+
+		SpecialBitsRate: opts.SpecialBitsRate,
+		UnreadableRate:  opts.UnreadableRate,
+
+		XattrsPerFile:  opts.XattrsPerFile,
+		XattrMaxSize:   opts.XattrMaxSize,
+		CapabilityRate: opts.CapabilityRate,
+		ACLRate:        opts.ACLRate,
+	}
+
+	if opts.MtimeRange != "" {
+		cfg.MtimeMin, cfg.MtimeMax, err = fakedata.ParseTimeRange(opts.MtimeRange)
+		if err != nil {
+			return fakedata.Config{}, err
+		}
+	}
+
+	if opts.Uids != "" {
+		cfg.Uids, err = fakedata.ParseIDs(opts.Uids)
+		if err != nil {
+			return fakedata.Config{}, err
+		}
+	}
+
+	if opts.Gids != "" {
+		cfg.Gids, err = fakedata.ParseIDs(opts.Gids)
+		if err != nil {
+			return fakedata.Config{}, err
+		}
+	}
+
+	cfg.Modes, err = fakedata.ParseModes(opts.Modes)
+	if err != nil {
+		return fakedata.Config{}, err
+	}
+
+	if opts.Spec != "" {
+		spec, err := fakedata.LoadSpec(opts.Spec)
+		if err != nil {
+			return fakedata.Config{}, err
+		}
+
+		cfg, err = fakedata.ApplySpec(cfg, spec)
+		if err != nil {
+			return fakedata.Config{}, fmt.Errorf("%v: %v", opts.Spec, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// printStats prints statistics about the tree described by opts.
+func printStats(opts Options) error {
+	cfg, err := config(opts)
+	if err != nil {
+		return err
+	}
+
+	fakefs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	stats, err := fakedata.TreeStats(fakefs.Root())
+	if err != nil {
+		return err
+	}
+
+	M("%v\n", stats)
+	return nil
+}
+
 func mount(opts Options) (*fuse.MountedFileSystem, error) {
-	fakefs, err := NewFakeDataFS(ctx, opts.Seed, opts.MaxSize*1024, opts.NumFiles)
+	cfg, err := config(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fakefs, err := NewFakeDataFS(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
+	fakefs.ReadWorkers = readWorkers(opts)
+
+	var faults []Fault
+	if opts.FaultsFile != "" {
+		faults, err = LoadFaults(opts.FaultsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range opts.Faults {
+		fault, err := ParseFault(s)
+		if err != nil {
+			return nil, err
+		}
+		faults = append(faults, fault)
+	}
+
+	writable := opts.Writable || opts.OverlayDir != ""
+	if writable && len(faults) > 0 {
+		return nil, errors.New("faults cannot be injected into a writable file system")
+	}
 
-	cfg := &fuse.MountConfig{
+	var server fuse.Server = fuseutil.NewFileSystemServer(fakefs)
+	switch {
+	case len(faults) > 0:
+		server = fuseutil.NewFileSystemServer(NewFaultFS(fakefs, faults))
+	case writable:
+		server = fuseutil.NewFileSystemServer(NewOverlayFS(fakefs, opts.OverlayDir))
+	}
+
+	mountCfg := &fuse.MountConfig{
 		FSName:      "fakedatafs",
-		ReadOnly:    true,
+		ReadOnly:    !writable,
 		ErrorLogger: log.New(os.Stderr, "ERROR: ", log.LstdFlags),
 	}
 
 	if opts.Debug {
-		cfg.DebugLogger = log.New(os.Stderr, "DEBUG: ", log.LstdFlags)
+		mountCfg.DebugLogger = log.New(os.Stderr, "DEBUG: ", log.LstdFlags)
 	}
 
 	fs, err := fuse.Mount(
 		opts.mountpoint,
-		fuseutil.NewFileSystemServer(fakefs),
-		cfg,
+		server,
+		mountCfg,
 	)
 	if err != nil {
 		return nil, err
@@ -115,12 +375,26 @@ func main() {
 		os.Exit(1)
 	}
 
+	// a command has been run
+	if parser.Active != nil {
+		return
+	}
+
 	if opts.Version {
 		fmt.Printf("version %v using %v on %v/%v\n",
 			version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
 		return
 	}
 
+	if opts.Stats {
+		err = printStats(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	if len(args) == 0 {
 		parser.WriteHelp(os.Stderr)
 		os.Exit(1)
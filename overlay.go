@@ -0,0 +1,909 @@
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+// firstOverlayInode is the inode of the first entry created in the overlay.
+// Generated entries have inodes up to fakedata.MaxInode, so they never
+// collide.
+const firstOverlayInode = fakedata.MaxInode + 1
+
+// Flags for SetXattr, see setxattr(2).
+const (
+	xattrCreate  = 1
+	xattrReplace = 2
+)
+
+// overlayNode is an entry which was created or changed in the overlay.
+type overlayNode struct {
+	Entry
+
+	// base is the number of bytes at the start of the file which are read
+	// from the generated File. Blocks which have been written are read from
+	// delta instead.
+	base    int64
+	delta   deltaStore
+	written map[int64]bool
+
+	// added and removed record the changes to the entries of a directory,
+	// order lists the names in added in the order they were created.
+	added   map[string]fuseops.InodeID
+	removed map[string]bool
+	order   []string
+}
+
+// readBase reads data which has not been written from the generated file.
+// Data after base is returned as null bytes.
+func (n *overlayNode) readBase(p []byte, off int64) error {
+	for i := range p {
+		p[i] = 0
+	}
+
+	if n.File == nil || off >= n.base {
+		return nil
+	}
+
+	if int64(len(p)) > n.base-off {
+		p = p[:n.base-off]
+	}
+
+	_, err := n.File.ReadAt(p, off)
+	return err
+}
+
+// readAt reads the current content of the file.
+func (n *overlayNode) readAt(p []byte, off int64) (int, error) {
+	size := int64(n.Attr.Size)
+	if off >= size {
+		return 0, nil
+	}
+
+	if int64(len(p)) > size-off {
+		p = p[:size-off]
+	}
+
+	for pos := 0; pos < len(p); {
+		cur := off + int64(pos)
+		buf := p[pos:]
+		if rest := deltaBlockSize - cur%deltaBlockSize; int64(len(buf)) > rest {
+			buf = buf[:rest]
+		}
+
+		var err error
+		if n.written[cur/deltaBlockSize] {
+			_, err = n.delta.ReadAt(buf, cur)
+		} else {
+			err = n.readBase(buf, cur)
+		}
+
+		if err != nil {
+			return pos, err
+		}
+
+		pos += len(buf)
+	}
+
+	return len(p), nil
+}
+
+// truncate changes the size of the file.
+func (n *overlayNode) truncate(size int64) error {
+	if size < n.base {
+		n.base = size
+	}
+
+	if n.delta != nil {
+		err := n.delta.Truncate(size)
+		if err != nil {
+			return err
+		}
+
+		for blk := range n.written {
+			if blk*deltaBlockSize >= size {
+				delete(n.written, blk)
+			}
+		}
+	}
+
+	n.Attr.Size = uint64(size)
+	return nil
+}
+
+// touch updates the modification time.
+func (n *overlayNode) touch() {
+	now := time.Now()
+	n.Attr.Mtime = now
+	n.Attr.Ctime = now
+}
+
+// OverlayFS records writes, new entries, renames and removals on top of the
+// generated data of a FakeDataFS. Entries are copied to the overlay when
+// they are changed, the data written to files is kept in blocks of
+// deltaBlockSize bytes, either in memory or in temporary files in a
+// directory. All other data is still read from the generated files.
+type OverlayFS struct {
+	*FakeDataFS
+
+	// dir is the directory for the written data, it is kept in memory if
+	// dir is empty.
+	dir string
+
+	m     sync.Mutex
+	nodes map[fuseops.InodeID]*overlayNode
+	next  fuseops.InodeID
+}
+
+// NewOverlayFS returns a writable file system on top of fs. The data
+// written to files is stored in temporary files in dir, or in memory if dir
+// is empty.
+func NewOverlayFS(fs *FakeDataFS, dir string) *OverlayFS {
+	return &OverlayFS{
+		FakeDataFS: fs,
+		dir:        dir,
+		nodes:      make(map[fuseops.InodeID]*overlayNode),
+		next:       firstOverlayInode,
+	}
+}
+
+// pin copies the entry for inode to the overlay. The caller must hold o.m.
+func (o *OverlayFS) pin(inode fuseops.InodeID) (*overlayNode, error) {
+	if n, ok := o.nodes[inode]; ok {
+		return n, nil
+	}
+
+	entry, ok := o.snapshot(inode)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	n := &overlayNode{Entry: entry, base: int64(entry.Attr.Size)}
+	n.Xattrs = append([]fakedata.Xattr(nil), entry.Xattrs...)
+	o.nodes[inode] = n
+	return n, nil
+}
+
+// dirNode copies the directory inode to the overlay. The caller must hold
+// o.m.
+func (o *OverlayFS) dirNode(inode fuseops.InodeID) (*overlayNode, error) {
+	n, err := o.pin(inode)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.Attr.Mode.IsDir() {
+		return nil, fuse.ENOTDIR
+	}
+
+	return n, nil
+}
+
+// child returns the entry name in the directory parent. The caller must
+// hold o.m.
+func (o *OverlayFS) child(parent *overlayNode, name string) (fakedata.DirEntry, bool) {
+	if inode, ok := parent.added[name]; ok {
+		n := o.nodes[inode]
+		return fakedata.DirEntry{
+			Dirent: fuseutil.Dirent{Name: name, Inode: inode, Type: fakedata.DirentType(n.Attr.Mode)},
+			Nlink:  n.Attr.Nlink,
+		}, true
+	}
+
+	if parent.removed[name] || parent.Dir == nil {
+		return fakedata.DirEntry{}, false
+	}
+
+	return parent.Dir.Lookup(name)
+}
+
+// list returns the entries of the directory inode. The caller must hold o.m.
+func (o *OverlayFS) list(inode fuseops.InodeID) ([]fuseutil.Dirent, error) {
+	var (
+		dir     *fakedata.Dir
+		order   []string
+		added   map[string]fuseops.InodeID
+		removed map[string]bool
+	)
+
+	if n, ok := o.nodes[inode]; ok {
+		dir, order, added, removed = n.Dir, n.order, n.added, n.removed
+	} else {
+		entry, ok := o.entry(inode)
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		dir = entry.Dir
+		if dir == nil {
+			return nil, fuse.ENOTDIR
+		}
+	}
+
+	var list []fuseutil.Dirent
+	if dir != nil {
+		for _, entry := range dir.Entries() {
+			if removed[entry.Name] {
+				continue
+			}
+			if _, ok := added[entry.Name]; ok {
+				continue
+			}
+			list = append(list, entry.Dirent)
+		}
+	}
+
+	for _, name := range order {
+		inode := added[name]
+		list = append(list, fuseutil.Dirent{
+			Name:  name,
+			Inode: inode,
+			Type:  fakedata.DirentType(o.nodes[inode].Attr.Mode),
+		})
+	}
+
+	for i := range list {
+		list[i].Offset = fuseops.DirOffset(i + 1)
+	}
+
+	return list, nil
+}
+
+// addChild adds the entry name for inode to parent. The caller must hold
+// o.m.
+func (o *OverlayFS) addChild(parent *overlayNode, name string, inode fuseops.InodeID) {
+	if parent.added == nil {
+		parent.added = make(map[string]fuseops.InodeID)
+	}
+
+	if _, ok := parent.added[name]; !ok {
+		parent.order = append(parent.order, name)
+	}
+
+	parent.added[name] = inode
+	parent.touch()
+}
+
+// removeChild removes the entry name from parent. The caller must hold o.m.
+func (o *OverlayFS) removeChild(parent *overlayNode, name string) {
+	if _, ok := parent.added[name]; ok {
+		delete(parent.added, name)
+		for i, n := range parent.order {
+			if n == name {
+				parent.order = append(parent.order[:i], parent.order[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if parent.removed == nil {
+		parent.removed = make(map[string]bool)
+	}
+
+	parent.removed[name] = true
+	parent.touch()
+}
+
+// create adds a new entry name with attr to parent and returns it in
+// child. The caller must hold o.m.
+func (o *OverlayFS) create(parent *overlayNode, name string, attr fuseops.InodeAttributes, target string, child *fuseops.ChildInodeEntry) error {
+	if _, ok := o.child(parent, name); ok {
+		return fuse.EEXIST
+	}
+
+	inode := o.next
+	o.next++
+
+	now := time.Now()
+	attr.Nlink = 1
+	attr.Atime, attr.Mtime, attr.Ctime, attr.Crtime = now, now, now, now
+	attr.Uid, attr.Gid = uint32(os.Getuid()), uint32(os.Getgid())
+
+	n := &overlayNode{
+		Entry: Entry{
+			Attr:    attr,
+			Path:    path.Join(parent.Path, name),
+			Target:  target,
+			lookups: 1,
+		},
+	}
+
+	o.nodes[inode] = n
+	o.addChild(parent, name, inode)
+
+	V("create %v in overlay\n", n.Path)
+	child.Child = inode
+	child.Attributes = n.Attr
+	return nil
+}
+
+// release removes the node for inode once it has no names and the kernel
+// does not reference it any more. The caller must hold o.m.
+func (o *OverlayFS) release(inode fuseops.InodeID, n *overlayNode) {
+	if n.Attr.Nlink > 0 || n.lookups > 0 {
+		return
+	}
+
+	if n.delta != nil {
+		err := n.delta.Close()
+		if err != nil {
+			V("removing delta for %v failed: %v\n", n.Path, err)
+		}
+	}
+
+	delete(o.nodes, inode)
+}
+
+// unlink removes the entry from parent. The caller must hold o.m.
+func (o *OverlayFS) unlink(parent *overlayNode, entry fakedata.DirEntry) {
+	o.removeChild(parent, entry.Name)
+
+	n, ok := o.nodes[entry.Inode]
+	if !ok && entry.Nlink > 1 {
+		// other names of the file need the new link count
+		n, _ = o.pin(entry.Inode)
+	}
+
+	if n == nil {
+		return
+	}
+
+	n.Attr.Nlink--
+	if n.Attr.Mode.IsDir() {
+		n.Attr.Nlink = 0
+	}
+	n.Attr.Ctime = time.Now()
+
+	o.release(entry.Inode, n)
+}
+
+// empty returns true if the directory inode has no entries. The caller must
+// hold o.m.
+func (o *OverlayFS) empty(inode fuseops.InodeID) (bool, error) {
+	list, err := o.list(inode)
+	return len(list) == 0, err
+}
+
+// write writes data to the file. The caller must hold o.m.
+func (o *OverlayFS) write(n *overlayNode, data []byte, off int64) error {
+	if n.delta == nil {
+		delta, err := newDeltaStore(o.dir)
+		if err != nil {
+			return err
+		}
+		n.delta = delta
+		n.written = make(map[int64]bool)
+	}
+
+	end := off + int64(len(data))
+	for blk := off / deltaBlockSize; blk*deltaBlockSize < end; blk++ {
+		start := blk * deltaBlockSize
+		if n.written[blk] || (off <= start && end >= start+deltaBlockSize) {
+			n.written[blk] = true
+			continue
+		}
+
+		// copy the rest of the block
+		buf := make([]byte, deltaBlockSize)
+		err := n.readBase(buf, start)
+		if err != nil {
+			return err
+		}
+
+		_, err = n.delta.WriteAt(buf, start)
+		if err != nil {
+			return err
+		}
+
+		n.written[blk] = true
+	}
+
+	_, err := n.delta.WriteAt(data, off)
+	if err != nil {
+		return err
+	}
+
+	if uint64(end) > n.Attr.Size {
+		n.Attr.Size = uint64(end)
+	}
+
+	n.touch()
+	return nil
+}
+
+// LookUpInode returns information on an inode.
+func (o *OverlayFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if parent, ok := o.nodes[op.Parent]; ok {
+		if !parent.Attr.Mode.IsDir() {
+			return fuse.ENOTDIR
+		}
+
+		if inode, ok := parent.added[op.Name]; ok {
+			n := o.nodes[inode]
+			n.lookups++
+			op.Entry.Child = inode
+			op.Entry.Attributes = n.Attr
+			return nil
+		}
+
+		if parent.removed[op.Name] || parent.Dir == nil {
+			return fuse.ENOENT
+		}
+
+		err := o.lookUp(parent.Dir, op.Name, &op.Entry)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := o.FakeDataFS.LookUpInode(ctx, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	// entries changed in place are still found in the generated directory
+	if n, ok := o.nodes[op.Entry.Child]; ok {
+		n.lookups++
+		op.Entry.Attributes = n.Attr
+	}
+
+	return nil
+}
+
+// GetInodeAttributes returns information about an inode.
+func (o *OverlayFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAttributesOp) error {
+	o.m.Lock()
+	n, ok := o.nodes[op.Inode]
+	if ok {
+		op.Attributes = n.Attr
+	}
+	o.m.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	return o.FakeDataFS.GetInodeAttributes(ctx, op)
+}
+
+// SetInodeAttributes changes the size, mode or times of an inode.
+func (o *OverlayFS) SetInodeAttributes(ctx context.Context, op *fuseops.SetInodeAttributesOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, err := o.pin(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	if op.Size != nil {
+		if !n.Attr.Mode.IsRegular() {
+			return fuse.EINVAL
+		}
+
+		err = n.truncate(int64(*op.Size))
+		if err != nil {
+			return err
+		}
+		n.touch()
+	}
+
+	if op.Mode != nil {
+		n.Attr.Mode = n.Attr.Mode&^fakedata.PermBits | *op.Mode&fakedata.PermBits
+	}
+
+	if op.Atime != nil {
+		n.Attr.Atime = *op.Atime
+	}
+
+	if op.Mtime != nil {
+		n.Attr.Mtime = *op.Mtime
+	}
+
+	n.Attr.Ctime = time.Now()
+	op.Attributes = n.Attr
+	return nil
+}
+
+// ForgetInode decrements the lookup count of an inode.
+func (o *OverlayFS) ForgetInode(ctx context.Context, op *fuseops.ForgetInodeOp) error {
+	o.m.Lock()
+	if n, ok := o.nodes[op.Inode]; ok {
+		if op.N < n.lookups {
+			n.lookups -= op.N
+		} else {
+			n.lookups = 0
+		}
+		o.release(op.Inode, n)
+	}
+	o.m.Unlock()
+
+	return o.FakeDataFS.ForgetInode(ctx, op)
+}
+
+// MkDir creates a directory.
+func (o *OverlayFS) MkDir(ctx context.Context, op *fuseops.MkDirOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	attr := fuseops.InodeAttributes{Mode: op.Mode&fakedata.PermBits | os.ModeDir}
+	return o.create(parent, op.Name, attr, "", &op.Entry)
+}
+
+// MkNode creates a file or a special file.
+func (o *OverlayFS) MkNode(ctx context.Context, op *fuseops.MkNodeOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	attr := fuseops.InodeAttributes{Mode: op.Mode}
+	return o.create(parent, op.Name, attr, "", &op.Entry)
+}
+
+// CreateFile creates a new file.
+func (o *OverlayFS) CreateFile(ctx context.Context, op *fuseops.CreateFileOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	attr := fuseops.InodeAttributes{Mode: op.Mode & fakedata.PermBits}
+	return o.create(parent, op.Name, attr, "", &op.Entry)
+}
+
+// CreateSymlink creates a symlink.
+func (o *OverlayFS) CreateSymlink(ctx context.Context, op *fuseops.CreateSymlinkOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	attr := fuseops.InodeAttributes{Mode: os.ModeSymlink | 0777, Size: uint64(len(op.Target))}
+	return o.create(parent, op.Name, attr, op.Target, &op.Entry)
+}
+
+// CreateLink creates a hardlink.
+func (o *OverlayFS) CreateLink(ctx context.Context, op *fuseops.CreateLinkOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := o.child(parent, op.Name); ok {
+		return fuse.EEXIST
+	}
+
+	n, err := o.pin(op.Target)
+	if err != nil {
+		return err
+	}
+
+	if n.Attr.Mode.IsDir() {
+		return syscall.EPERM
+	}
+
+	o.addChild(parent, op.Name, op.Target)
+	n.Attr.Nlink++
+	n.Attr.Ctime = time.Now()
+	n.lookups++
+
+	op.Entry.Child = op.Target
+	op.Entry.Attributes = n.Attr
+	return nil
+}
+
+// Rename moves an entry to a new name.
+func (o *OverlayFS) Rename(ctx context.Context, op *fuseops.RenameOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	oldParent, err := o.dirNode(op.OldParent)
+	if err != nil {
+		return err
+	}
+
+	newParent, err := o.dirNode(op.NewParent)
+	if err != nil {
+		return err
+	}
+
+	src, ok := o.child(oldParent, op.OldName)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	if dst, ok := o.child(newParent, op.NewName); ok {
+		if dst.Inode == src.Inode {
+			return nil
+		}
+
+		srcDir, dstDir := src.Type == fuseutil.DT_Directory, dst.Type == fuseutil.DT_Directory
+		switch {
+		case dstDir && !srcDir:
+			return syscall.EISDIR
+		case srcDir && !dstDir:
+			return fuse.ENOTDIR
+		case dstDir:
+			empty, err := o.empty(dst.Inode)
+			if err != nil {
+				return err
+			}
+			if !empty {
+				return fuse.ENOTEMPTY
+			}
+		}
+
+		o.unlink(newParent, dst)
+	}
+
+	n, err := o.pin(src.Inode)
+	if err != nil {
+		return err
+	}
+
+	o.removeChild(oldParent, op.OldName)
+	o.addChild(newParent, op.NewName, src.Inode)
+
+	V("rename %v to %v in overlay\n", n.Path, path.Join(newParent.Path, op.NewName))
+	n.Path = path.Join(newParent.Path, op.NewName)
+	n.Attr.Ctime = time.Now()
+	return nil
+}
+
+// Unlink removes a file.
+func (o *OverlayFS) Unlink(ctx context.Context, op *fuseops.UnlinkOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := o.child(parent, op.Name)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	if entry.Type == fuseutil.DT_Directory {
+		return syscall.EISDIR
+	}
+
+	o.unlink(parent, entry)
+	return nil
+}
+
+// RmDir removes an empty directory.
+func (o *OverlayFS) RmDir(ctx context.Context, op *fuseops.RmDirOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	parent, err := o.dirNode(op.Parent)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := o.child(parent, op.Name)
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	if entry.Type != fuseutil.DT_Directory {
+		return fuse.ENOTDIR
+	}
+
+	empty, err := o.empty(entry.Inode)
+	if err != nil {
+		return err
+	}
+
+	if !empty {
+		return fuse.ENOTEMPTY
+	}
+
+	o.unlink(parent, entry)
+	return nil
+}
+
+// ReadDir lists a directory.
+func (o *OverlayFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
+	o.m.Lock()
+	if _, ok := o.nodes[op.Inode]; !ok {
+		o.m.Unlock()
+		return o.FakeDataFS.ReadDir(ctx, op)
+	}
+	defer o.m.Unlock()
+
+	list, err := o.list(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	if int(op.Offset) > len(list) {
+		return fuse.EIO
+	}
+
+	for _, dirent := range list[op.Offset:] {
+		written := fuseutil.WriteDirent(op.Dst[op.BytesRead:], dirent)
+		if written == 0 {
+			break
+		}
+
+		op.BytesRead += written
+	}
+
+	return nil
+}
+
+// ReadFile reads data from a file.
+func (o *OverlayFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) (err error) {
+	o.m.Lock()
+	n, ok := o.nodes[op.Inode]
+	if !ok {
+		o.m.Unlock()
+		return o.FakeDataFS.ReadFile(ctx, op)
+	}
+	defer o.m.Unlock()
+
+	op.BytesRead, err = n.readAt(op.Dst, op.Offset)
+	return err
+}
+
+// WriteFile writes data to a file.
+func (o *OverlayFS) WriteFile(ctx context.Context, op *fuseops.WriteFileOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, err := o.pin(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	if !n.Attr.Mode.IsRegular() {
+		return fuse.EIO
+	}
+
+	return o.write(n, op.Data, op.Offset)
+}
+
+// SyncFile does nothing, the overlay is not persistent.
+func (o *OverlayFS) SyncFile(ctx context.Context, op *fuseops.SyncFileOp) error {
+	return nil
+}
+
+// FlushFile does nothing, all writes are applied immediately.
+func (o *OverlayFS) FlushFile(ctx context.Context, op *fuseops.FlushFileOp) error {
+	return nil
+}
+
+// ReleaseFileHandle frees a handle returned by OpenFile or CreateFile.
+func (o *OverlayFS) ReleaseFileHandle(ctx context.Context, op *fuseops.ReleaseFileHandleOp) error {
+	return nil
+}
+
+// ReadSymlink returns the target of a symlink.
+func (o *OverlayFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) error {
+	o.m.Lock()
+	n, ok := o.nodes[op.Inode]
+	o.m.Unlock()
+
+	if !ok {
+		return o.FakeDataFS.ReadSymlink(ctx, op)
+	}
+
+	if n.Attr.Mode&os.ModeSymlink == 0 {
+		return fuse.EINVAL
+	}
+
+	op.Target = n.Target
+	return nil
+}
+
+// GetXattr returns the value of an extended attribute.
+func (o *OverlayFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) (err error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, ok := o.nodes[op.Inode]
+	if !ok {
+		return o.FakeDataFS.GetXattr(ctx, op)
+	}
+
+	op.BytesRead, err = getXattr(n.Xattrs, op.Name, op.Dst)
+	return err
+}
+
+// ListXattr lists the names of all extended attributes.
+func (o *OverlayFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) (err error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, ok := o.nodes[op.Inode]
+	if !ok {
+		return o.FakeDataFS.ListXattr(ctx, op)
+	}
+
+	op.BytesRead, err = listXattr(n.Xattrs, op.Dst)
+	return err
+}
+
+// SetXattr sets the value of an extended attribute.
+func (o *OverlayFS) SetXattr(ctx context.Context, op *fuseops.SetXattrOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, err := o.pin(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	value := append([]byte(nil), op.Value...)
+	for i, attr := range n.Xattrs {
+		if attr.Name == op.Name {
+			if op.Flags&xattrCreate != 0 {
+				return fuse.EEXIST
+			}
+			n.Xattrs[i].Value = value
+			n.Attr.Ctime = time.Now()
+			return nil
+		}
+	}
+
+	if op.Flags&xattrReplace != 0 {
+		return syscall.ENODATA
+	}
+
+	n.Xattrs = append(n.Xattrs, fakedata.Xattr{Name: op.Name, Value: value})
+	n.Attr.Ctime = time.Now()
+	return nil
+}
+
+// RemoveXattr removes an extended attribute.
+func (o *OverlayFS) RemoveXattr(ctx context.Context, op *fuseops.RemoveXattrOp) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	n, err := o.pin(op.Inode)
+	if err != nil {
+		return err
+	}
+
+	for i, attr := range n.Xattrs {
+		if attr.Name == op.Name {
+			n.Xattrs = append(n.Xattrs[:i], n.Xattrs[i+1:]...)
+			n.Attr.Ctime = time.Now()
+			return nil
+		}
+	}
+
+	return syscall.ENODATA
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+func newTestOverlayFS(t testing.TB, ctx context.Context, dir string) *OverlayFS {
+	cfg := fakedata.Config{Seed: 23, MaxSize: 512 * 1024, FilesPerDir: 10, DirsPerDir: 2, Depth: 1}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewOverlayFS(fs, dir)
+}
+
+func overlayLookup(ctx context.Context, o *OverlayFS, parent fuseops.InodeID, name string) (fuseops.ChildInodeEntry, error) {
+	op := &fuseops.LookUpInodeOp{Parent: parent, Name: name}
+	err := o.LookUpInode(ctx, op)
+	return op.Entry, err
+}
+
+func overlayRead(t testing.TB, ctx context.Context, o *OverlayFS, inode fuseops.InodeID) []byte {
+	op := &fuseops.ReadFileOp{Inode: inode, Dst: make([]byte, 2<<20)}
+	err := o.ReadFile(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return op.Dst[:op.BytesRead]
+}
+
+func overlayList(t testing.TB, ctx context.Context, o *OverlayFS, inode fuseops.InodeID) map[string]bool {
+	op := &fuseops.ReadDirOp{Inode: inode, Dst: make([]byte, 64*1024)}
+	err := o.ReadDir(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := o.list(inode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]bool)
+	n := 0
+	for _, dirent := range entries {
+		names[dirent.Name] = true
+		n += fuseutil.WriteDirent(make([]byte, 1024), dirent)
+	}
+
+	if n != op.BytesRead {
+		t.Errorf("ReadDir returned %d bytes, want %d", op.BytesRead, n)
+	}
+
+	return names
+}
+
+// firstFile returns the first generated file in the root directory.
+func firstFile(t testing.TB, ctx context.Context, o *OverlayFS) (string, fuseops.ChildInodeEntry) {
+	for _, entry := range o.Root().Entries() {
+		if entry.Type == fuseutil.DT_File && entry.Size > 3*deltaBlockSize {
+			child, err := overlayLookup(ctx, o, fuseops.RootInodeID, entry.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return entry.Name, child
+		}
+	}
+
+	t.Fatal("no file found")
+	return "", fuseops.ChildInodeEntry{}
+}
+
+func testOverlayWrite(t *testing.T, dir string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := newTestOverlayFS(t, ctx, dir)
+	_, file := firstFile(t, ctx, o)
+	want := overlayRead(t, ctx, o, file.Child)
+
+	data := bytes.Repeat([]byte("x"), deltaBlockSize+100)
+	off := int64(deltaBlockSize - 50)
+	err := o.WriteFile(ctx, &fuseops.WriteFileOp{Inode: file.Child, Offset: off, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(want[off:], data)
+
+	if got := overlayRead(t, ctx, o, file.Child); !bytes.Equal(got, want) {
+		t.Fatalf("wrong content after write")
+	}
+
+	// truncate and extend the file again, the data in between is zero
+	size := uint64(100)
+	err = o.SetInodeAttributes(ctx, &fuseops.SetInodeAttributesOp{Inode: file.Child, Size: &size})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := int64(3*deltaBlockSize + 10)
+	err = o.WriteFile(ctx, &fuseops.WriteFileOp{Inode: file.Child, Offset: end, Data: []byte("end")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = append(want[:100], make([]byte, end-100)...)
+	want = append(want, "end"...)
+	if got := overlayRead(t, ctx, o, file.Child); !bytes.Equal(got, want) {
+		t.Fatalf("wrong content after truncate")
+	}
+
+	attr := &fuseops.GetInodeAttributesOp{Inode: file.Child}
+	err = o.GetInodeAttributes(ctx, attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attr.Attributes.Size != uint64(len(want)) {
+		t.Errorf("wrong size %v, want %v", attr.Attributes.Size, len(want))
+	}
+}
+
+func TestOverlayWrite(t *testing.T) {
+	testOverlayWrite(t, "")
+}
+
+func TestOverlayWriteDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakedatafs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testOverlayWrite(t, dir)
+}
+
+func TestOverlayCreate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := newTestOverlayFS(t, ctx, "")
+
+	mkdir := &fuseops.MkDirOp{Parent: fuseops.RootInodeID, Name: "new", Mode: 0755}
+	err := o.MkDir(ctx, mkdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := &fuseops.CreateFileOp{Parent: mkdir.Entry.Child, Name: "file", Mode: 0600}
+	err = o.CreateFile(ctx, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.CreateFile(ctx, create)
+	if err != fuse.EEXIST {
+		t.Errorf("creating a file twice returned %v", err)
+	}
+
+	err = o.WriteFile(ctx, &fuseops.WriteFileOp{Inode: create.Entry.Child, Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symlink := &fuseops.CreateSymlinkOp{Parent: mkdir.Entry.Child, Name: "link", Target: "file"}
+	err = o.CreateSymlink(ctx, symlink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := &fuseops.CreateLinkOp{Parent: fuseops.RootInodeID, Name: "hardlink", Target: create.Entry.Child}
+	err = o.CreateLink(ctx, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link.Entry.Attributes.Nlink != 2 {
+		t.Errorf("wrong link count %v", link.Entry.Attributes.Nlink)
+	}
+
+	names := overlayList(t, ctx, o, mkdir.Entry.Child)
+	if len(names) != 2 || !names["file"] || !names["link"] {
+		t.Errorf("wrong entries %v", names)
+	}
+
+	if !overlayList(t, ctx, o, fuseops.RootInodeID)["new"] {
+		t.Errorf("new directory is not listed")
+	}
+
+	child, err := overlayLookup(ctx, o, fuseops.RootInodeID, "hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := overlayRead(t, ctx, o, child.Child); string(got) != "hello" {
+		t.Errorf("wrong content %q", got)
+	}
+
+	readlink := &fuseops.ReadSymlinkOp{Inode: symlink.Entry.Child}
+	err = o.ReadSymlink(ctx, readlink)
+	if err != nil || readlink.Target != "file" {
+		t.Errorf("wrong symlink target %q: %v", readlink.Target, err)
+	}
+
+	err = o.RmDir(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: "new"})
+	if err != fuse.ENOTEMPTY {
+		t.Errorf("removing non-empty dir returned %v", err)
+	}
+
+	for _, name := range []string{"file", "link"} {
+		err = o.Unlink(ctx, &fuseops.UnlinkOp{Parent: mkdir.Entry.Child, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = o.RmDir(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is still reachable through the hardlink
+	if got := overlayRead(t, ctx, o, child.Child); string(got) != "hello" {
+		t.Errorf("wrong content %q after unlink", got)
+	}
+}
+
+func TestOverlayRename(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := newTestOverlayFS(t, ctx, "")
+	name, file := firstFile(t, ctx, o)
+	want := overlayRead(t, ctx, o, file.Child)
+
+	var dir fuseops.ChildInodeEntry
+	for _, entry := range o.Root().Entries() {
+		if entry.Type == fuseutil.DT_Directory {
+			var err error
+			dir, err = overlayLookup(ctx, o, fuseops.RootInodeID, entry.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+
+	err := o.Rename(ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID, OldName: name,
+		NewParent: dir.Child, NewName: "moved",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = overlayLookup(ctx, o, fuseops.RootInodeID, name); err != fuse.ENOENT {
+		t.Errorf("old name still found: %v", err)
+	}
+
+	if overlayList(t, ctx, o, fuseops.RootInodeID)[name] {
+		t.Errorf("old name still listed")
+	}
+
+	moved, err := overlayLookup(ctx, o, dir.Child, "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moved.Child != file.Child {
+		t.Errorf("inode changed on rename")
+	}
+
+	if got := overlayRead(t, ctx, o, moved.Child); !bytes.Equal(got, want) {
+		t.Errorf("content changed on rename")
+	}
+
+	err = o.RmDir(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: "moved"})
+	if err != fuse.ENOENT {
+		t.Errorf("rmdir of missing entry returned %v", err)
+	}
+
+	// generated subdirectories are not empty
+	var subdir string
+	for _, entry := range o.Root().Entries() {
+		if entry.Type == fuseutil.DT_Directory {
+			subdir = entry.Name
+		}
+	}
+
+	if _, err = overlayLookup(ctx, o, fuseops.RootInodeID, subdir); err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.RmDir(ctx, &fuseops.RmDirOp{Parent: fuseops.RootInodeID, Name: subdir})
+	if err != fuse.ENOTEMPTY {
+		t.Errorf("rmdir of generated dir returned %v", err)
+	}
+}
+
+func TestOverlayXattr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o := newTestOverlayFS(t, ctx, "")
+	_, file := firstFile(t, ctx, o)
+
+	err := o.SetXattr(ctx, &fuseops.SetXattrOp{Inode: file.Child, Name: "user.test", Value: []byte("value")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := &fuseops.GetXattrOp{Inode: file.Child, Name: "user.test", Dst: make([]byte, 100)}
+	err = o.GetXattr(ctx, get)
+	if err != nil || string(get.Dst[:get.BytesRead]) != "value" {
+		t.Errorf("wrong value %q: %v", get.Dst[:get.BytesRead], err)
+	}
+
+	err = o.RemoveXattr(ctx, &fuseops.RemoveXattrOp{Inode: file.Child, Name: "user.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = o.GetXattr(ctx, get)
+	if err == nil {
+		t.Errorf("removed attribute still found")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+// volatileState tracks a file which changes while it is being read.
+type volatileState struct {
+	change  fakedata.Change
+	reads   int
+	start   time.Time
+	applied bool
+}
+
+// registerVolatile starts tracking the file described by entry if it is
+// volatile, until the kernel forgets the inode. The caller must hold f.m.
+func (f *FakeDataFS) registerVolatile(entry fakedata.DirEntry) {
+	if _, ok := f.volatile[entry.Inode]; ok {
+		return
+	}
+
+	c, ok := f.VolatileChange(entry)
+	if !ok {
+		return
+	}
+
+	V("file %v is volatile: %v\n", entry.Name, c)
+	f.volatile[entry.Inode] = &volatileState{change: c, start: time.Now()}
+}
+
+// forgetVolatile removes the state of a volatile file which the kernel has
+// forgotten. Only the state of files which have been changed is kept, so
+// they do not change back, the memory for all other files is released. The
+// caller must hold f.m.
+func (f *FakeDataFS) forgetVolatile(inode fuseops.InodeID) {
+	if st, ok := f.volatile[inode]; ok && !st.applied {
+		delete(f.volatile, inode)
+	}
+}
+
+// countRead counts a read of a volatile file. The caller must hold f.m.
+func (f *FakeDataFS) countRead(inode fuseops.InodeID) {
+	if st, ok := f.volatile[inode]; ok {
+		st.reads++
+	}
+}
+
+// checkVolatile applies the change to a volatile file once it has been read
+// VolatileReads times or VolatileDelay has passed since it was first looked
+// up. The caller must hold f.m.
+func (f *FakeDataFS) checkVolatile(inode fuseops.InodeID, entry *Entry) {
+	st, ok := f.volatile[inode]
+	if !ok || entry.File == nil {
+		return
+	}
+
+	if !st.applied {
+		reads := f.VolatileReads > 0 && st.reads >= f.VolatileReads
+		delay := f.VolatileDelay > 0 && time.Since(st.start) >= f.VolatileDelay
+		if !reads && !delay {
+			return
+		}
+
+		V("change volatile file %v: %v\n", entry.Path, st.change)
+		st.applied = true
+	}
+
+	if entry.changed {
+		return
+	}
+
+	// readers may still use the old file, so change a copy
+	file := *entry.File
+	file.Segments = append([]fakedata.Segment(nil), file.Segments...)
+	file.Apply(st.change)
+
+	// the change is made at a random time during the next generation
+	mtime := f.ChangeTime(st.change)
+
+	entry.File = &file
+	entry.Attr.Size = uint64(file.Size)
+	entry.Attr.Mtime = mtime
+	entry.Attr.Ctime = mtime
+	entry.changed = true
+
+	f.cache.Drop(inode)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+func readTestFile(t testing.TB, ctx context.Context, fs *FakeDataFS, inode fuseops.InodeID, size int) []byte {
+	op := &fuseops.ReadFileOp{Inode: inode, Dst: make([]byte, size)}
+	err := fs.ReadFile(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return op.Dst[:op.BytesRead]
+}
+
+func TestVolatileReads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 20, VolatileRate: 1, VolatileReads: 2}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[fakedata.ChangeKind]int)
+	for _, dirent := range fs.Root().Entries() {
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: dirent.Name}
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inode := lookup.Entry.Child
+		before := lookup.Entry.Attributes
+		c, ok := cfg.VolatileChange(dirent)
+		if !ok {
+			t.Fatalf("%v is not volatile", dirent.Name)
+		}
+		kinds[c.Kind]++
+
+		buf1 := readTestFile(t, ctx, fs, inode, 2<<20)
+		buf2 := readTestFile(t, ctx, fs, inode, 2<<20)
+		if !bytes.Equal(buf1, buf2) {
+			t.Fatalf("%v: content changed too early", dirent.Name)
+		}
+
+		op := &fuseops.GetInodeAttributesOp{Inode: inode}
+		err = fs.GetInodeAttributes(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		after := op.Attributes
+		if !after.Mtime.After(before.Mtime) {
+			t.Errorf("%v: mtime not updated", dirent.Name)
+		}
+
+		buf3 := readTestFile(t, ctx, fs, inode, 2<<20)
+		if len(buf3) != int(after.Size) {
+			t.Errorf("%v: read %d bytes, but size is %d", dirent.Name, len(buf3), after.Size)
+		}
+
+		switch c.Kind {
+		case fakedata.ChangeAppend:
+			if after.Size <= before.Size {
+				t.Errorf("%v: size did not increase", dirent.Name)
+			}
+		case fakedata.ChangeModify:
+			if len(buf1) > 0 && bytes.Equal(buf1, buf3) {
+				t.Errorf("%v: content did not change", dirent.Name)
+			}
+		case fakedata.ChangeTouch:
+			if !bytes.Equal(buf1, buf3) {
+				t.Errorf("%v: content changed", dirent.Name)
+			}
+		}
+
+		// the file must not change back when the kernel forgets it
+		err = fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lookup.Entry.Attributes.Size != after.Size || !lookup.Entry.Attributes.Mtime.Equal(after.Mtime) {
+			t.Errorf("%v: file changed back after forget", dirent.Name)
+		}
+	}
+
+	if len(kinds) < 3 {
+		t.Errorf("want several kinds of changes, got %v", kinds)
+	}
+}
+
+func TestVolatileDelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 1, VolatileRate: 1, VolatileDelay: 50 * time.Millisecond}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: fs.Root().Entries()[0].Name}
+	err = fs.LookUpInode(ctx, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := &fuseops.GetInodeAttributesOp{Inode: lookup.Entry.Child}
+	err = fs.GetInodeAttributes(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !op.Attributes.Mtime.Equal(lookup.Entry.Attributes.Mtime) {
+		t.Fatalf("file changed too early")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	err = fs.GetInodeAttributes(ctx, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op.Attributes.Mtime.Equal(lookup.Entry.Attributes.Mtime) {
+		t.Errorf("file did not change after delay")
+	}
+}
+
+func TestVolatileForget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 1 << 20, FilesPerDir: 20, VolatileRate: 1, VolatileReads: 2}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dirent := range fs.Root().Entries() {
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: dirent.Name}
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inode := lookup.Entry.Child
+		readTestFile(t, ctx, fs, inode, 4096)
+
+		err = fs.ForgetInode(ctx, &fuseops.ForgetInodeOp{Inode: inode, N: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// files which have not been changed yet are not tracked any more
+	if len(fs.volatile) != 0 {
+		t.Errorf("state for %d forgotten files remains", len(fs.volatile))
+	}
+
+	if len(fs.cache.entries) != 0 {
+		t.Errorf("%d cached readers remain for forgotten files", len(fs.cache.entries))
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"syscall"
+
+	"github.com/restic/fakedatafs/fakedata"
+)
+
+// getXattr copies the value of the attribute name to dst. If dst is empty,
+// only the size of the value is returned.
+func getXattr(attrs []fakedata.Xattr, name string, dst []byte) (int, error) {
+	for _, attr := range attrs {
+		if attr.Name != name {
+			continue
+		}
+
+		if len(dst) == 0 {
+			return len(attr.Value), nil
+		}
+
+		if len(dst) < len(attr.Value) {
+			return len(attr.Value), syscall.ERANGE
+		}
+
+		return copy(dst, attr.Value), nil
+	}
+
+	return 0, syscall.ENODATA
+}
+
+// listXattr writes the null terminated names of attrs to dst. If dst is
+// empty, only the size needed is returned.
+func listXattr(attrs []fakedata.Xattr, dst []byte) (int, error) {
+	size := 0
+	for _, attr := range attrs {
+		size += len(attr.Name) + 1
+	}
+
+	if len(dst) == 0 {
+		return size, nil
+	}
+
+	if len(dst) < size {
+		return size, syscall.ERANGE
+	}
+
+	n := 0
+	for _, attr := range attrs {
+		n += copy(dst[n:], attr.Name)
+		dst[n] = 0
+		n++
+	}
+
+	return n, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/restic/fakedatafs/fakedata"
+	"golang.org/x/net/context"
+)
+
+func TestXattrs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := fakedata.Config{Seed: 23, MaxSize: 1024, FilesPerDir: 20, XattrsPerFile: 3, XattrMaxSize: 100, CapabilityRate: 0.5, ACLRate: 0.5}
+	fs, err := NewFakeDataFS(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]int)
+	for _, dirent := range fs.Root().Entries() {
+		lookup := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: dirent.Name}
+		err = fs.LookUpInode(ctx, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inode := lookup.Entry.Child
+
+		list := &fuseops.ListXattrOp{Inode: inode}
+		err = fs.ListXattr(ctx, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		list.Dst = make([]byte, list.BytesRead)
+		err = fs.ListXattr(ctx, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range strings.Split(strings.TrimSuffix(string(list.Dst), "\x00"), "\x00") {
+			names[name]++
+
+			get := &fuseops.GetXattrOp{Inode: inode, Name: name}
+			err = fs.GetXattr(ctx, get)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size := get.BytesRead
+			get.Dst = make([]byte, size)
+			err = fs.GetXattr(ctx, get)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, _ := xattrValue(fs.Root().EntryXattrs(dirent), name)
+			if !bytes.Equal(get.Dst, want) {
+				t.Errorf("%v: wrong value for %v", dirent.Name, name)
+			}
+
+			if name == "system.posix_acl_access" {
+				checkACL(t, get.Dst)
+			}
+
+			if size > 1 {
+				get.Dst = make([]byte, size-1)
+				err = fs.GetXattr(ctx, get)
+				if err != syscall.ERANGE {
+					t.Errorf("want ERANGE for small buffer, got %v", err)
+				}
+			}
+		}
+
+		err = fs.GetXattr(ctx, &fuseops.GetXattrOp{Inode: inode, Name: "user.missing"})
+		if err != fuse.ENOATTR {
+			t.Errorf("want ENOATTR for missing attribute, got %v", err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if names[fmt.Sprintf("user.fakedatafs.%d", i)] != 20 {
+			t.Errorf("user attribute %d missing: %v", i, names)
+		}
+	}
+
+	if names["security.capability"] == 0 || names["system.posix_acl_access"] == 0 {
+		t.Errorf("capabilities or ACLs missing: %v", names)
+	}
+}
+
+func xattrValue(attrs []fakedata.Xattr, name string) ([]byte, bool) {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return nil, false
+}
+
+func checkACL(t testing.TB, buf []byte) {
+	if len(buf) < 4 || (len(buf)-4)%8 != 0 {
+		t.Fatalf("invalid ACL length %d", len(buf))
+	}
+
+	if binary.LittleEndian.Uint32(buf) != 2 {
+		t.Errorf("invalid ACL version")
+	}
+
+	prev := uint16(0)
+	for pos := 4; pos < len(buf); pos += 8 {
+		tag := binary.LittleEndian.Uint16(buf[pos:])
+		if tag < prev {
+			t.Errorf("ACL entries not sorted")
+		}
+		prev = tag
+	}
+}